@@ -3,28 +3,93 @@ package controllers
 import (
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/ivinayakg/go-lift-simulation/models"
 	"github.com/ivinayakg/go-lift-simulation/services"
+	"github.com/ivinayakg/go-lift-simulation/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error string     `json:"error"`
+	Kind  utils.Kind `json:"kind,omitempty"`
+	// Fields holds a message for every field of the body that failed validation.
+	Fields FieldErrors `json:"fields,omitempty"`
 }
 
 type SessionCreateRequestBody struct {
 	Floors int `json:"floors"`
-	Lifts  int `json:"lifts"`
+	// MinFloor and MaxFloor number the floors, like -3 to 20 for a building
+	// with three basements. Floors can be left out when MaxFloor is given, the
+	// floors run from 0 up to Floors-1 when both are left out.
+	MinFloor *int `json:"minFloor"`
+	MaxFloor *int `json:"maxFloor"`
+	Lifts    int  `json:"lifts"`
+	// Kinematics of the lifts, any left out fall back to the defaults.
+	SecondsPerFloor float64 `json:"secondsPerFloor"`
+	DoorDwell       float64 `json:"doorDwell"`
+	Acceleration    float64 `json:"acceleration"`
+	// DispatchMode is conventional, the default, or destination.
+	DispatchMode string `json:"dispatchMode"`
+	// Capacity of every lift, in persons and kg, zero is unlimited.
+	Capacity models.Capacity `json:"capacity"`
+	Building models.Building `json:"building"`
+	// Faults makes lifts break down at random, give it a seed to replay a run.
+	Faults models.FaultConfig `json:"faults"`
+	// LiftConfigs describes every lift on its own, Lifts can be left out then.
+	// Anything a lift leaves out comes from the fields above.
+	LiftConfigs []models.LiftConfig `json:"liftConfigs"`
 }
 
 type LiftRequestCreateRequestBody struct {
+	Floor int `json:"floor"`
+	// Direction is up or down, it defaults to up, or down on the top floor.
+	Direction string `json:"direction"`
+	// From and To are the trip a passenger keys in at the hall of a destination
+	// dispatch session, From stands in for Floor.
+	From     *int               `json:"from"`
+	To       *int               `json:"to"`
+	ClientId primitive.ObjectID `json:"clientId"`
+}
+
+type DestinationCreateRequestBody struct {
 	Floor    int                `json:"floor"`
 	ClientId primitive.ObjectID `json:"clientId"`
 }
 
+type MaintenanceRequestBody struct {
+	// OutOfService takes the lift out of service, false puts it back. It
+	// defaults to true.
+	OutOfService *bool              `json:"outOfService"`
+	ClientId     primitive.ObjectID `json:"clientId"`
+}
+
+type EmergencyRequestBody struct {
+	// Active starts the recall, false clears it. It defaults to true.
+	Active *bool `json:"active"`
+	// Floor is the evacuation floor, the ground floor when left out.
+	Floor    *int               `json:"floor"`
+	ClientId primitive.ObjectID `json:"clientId"`
+}
+
+type PassengerCreateRequestBody struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Weight in kg, it defaults to models.DefaultPassengerWeight.
+	Weight   float64            `json:"weight"`
+	ClientId primitive.ObjectID `json:"clientId"`
+}
+
+type SessionSpeedRequestBody struct {
+	Action     string             `json:"action"`
+	Multiplier float64            `json:"multiplier"`
+	ClientId   primitive.ObjectID `json:"clientId"`
+}
+
 var methodChoices = map[string]string{
 	"get":   "GET",
 	"post":  "POST",
@@ -33,7 +98,22 @@ var methodChoices = map[string]string{
 }
 
 func sendJSONError(w http.ResponseWriter, statusCode int, errorMessage string) {
-	errorResponse := ErrorResponse{Error: errorMessage}
+	sendJSONErrorResponse(w, statusCode, ErrorResponse{Error: errorMessage})
+}
+
+// sendError answers with the status the kind of the error maps to, unexpected
+// errors are logged and hidden from the client.
+func sendError(w http.ResponseWriter, err error) {
+	if utils.KindOf(err) == utils.KindInternal {
+		log.Println(err)
+	}
+	if retryAfter := utils.RetryAfter(err); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	sendJSONErrorResponse(w, utils.HTTPStatus(err), ErrorResponse{Error: utils.PublicMessage(err), Kind: utils.KindOf(err)})
+}
+
+func sendJSONErrorResponse(w http.ResponseWriter, statusCode int, errorResponse ErrorResponse) {
 	w.Header().Set("content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(errorResponse)
@@ -56,28 +136,63 @@ func CreateSession(w http.ResponseWriter, r *http.Request) {
 	setHeaders("POST", w)
 	var body SessionCreateRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if fields := body.Validate(); len(fields) > 0 {
+		sendValidationError(w, fields)
 		return
 	}
 
-	floorsNumber := body.Floors
-	liftsNumber := body.Lifts
+	kinematics := models.Kinematics{SecondsPerFloor: body.SecondsPerFloor, DoorDwell: body.DoorDwell, Acceleration: body.Acceleration}
 
-	session, err := models.CreateSession(floorsNumber, liftsNumber)
+	minFloor, _ := body.floorRange()
+	config := models.SessionConfig{Floors: body.Floors, MinFloor: minFloor, Kinematics: kinematics, DispatchMode: body.DispatchMode, Building: body.Building, Faults: body.Faults, Lifts: body.liftConfigs()}
+	session, err := models.CreateSession(config)
 	if err != nil {
-		sendJSONError(w, http.StatusBadRequest, err.Error())
+		sendError(w, err)
 		return
 	}
+	services.Pubsubsys.OpenQueue(session.ID)
 	json.NewEncoder(w).Encode(session)
 }
 
+// floorRange is the lowest and highest floor of the session to create.
+func (body *SessionCreateRequestBody) floorRange() (int, int) {
+	minFloor := 0
+	if body.MinFloor != nil {
+		minFloor = *body.MinFloor
+	}
+	if body.MaxFloor != nil {
+		return minFloor, *body.MaxFloor
+	}
+	return minFloor, minFloor + body.Floors - 1
+}
+
+// liftConfigs returns the lifts to create, identical ones when the body only
+// gives their number, with the session wide capacity filled in.
+func (body *SessionCreateRequestBody) liftConfigs() []models.LiftConfig {
+	liftConfigs := body.LiftConfigs
+	if len(liftConfigs) == 0 {
+		liftConfigs = make([]models.LiftConfig, body.Lifts)
+	}
+	for i := range liftConfigs {
+		if liftConfigs[i].Capacity == (models.Capacity{}) {
+			liftConfigs[i].Capacity = body.Capacity
+		}
+	}
+	return liftConfigs
+}
+
 func GetSession(w http.ResponseWriter, r *http.Request) {
 	setHeaders("get", w)
 	vars := mux.Vars(r)
 	sessionID := vars["id"]
 	payload, err := models.GetSession(sessionID)
 	if err != nil {
-		log.Fatal(err)
+		sendError(w, err)
+		return
 	}
 
 	json.NewEncoder(w).Encode(payload)
@@ -90,7 +205,7 @@ func GetLiftRequests(w http.ResponseWriter, r *http.Request) {
 	statusValue := r.URL.Query().Get("status")
 	payload, err := models.GetLiftRequests(sessionID, statusValue)
 	if err != nil {
-		sendJSONError(w, http.StatusBadRequest, err.Error())
+		sendError(w, err)
 		return
 	}
 	json.NewEncoder(w).Encode(payload)
@@ -100,24 +215,255 @@ func CreateLiftRequest(w http.ResponseWriter, r *http.Request) {
 	setHeaders("POST", w)
 	var body LiftRequestCreateRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		sendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	vars := mux.Vars(r)
 	sessionID := vars["id"]
 
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	if fields := body.Validate(session); len(fields) > 0 {
+		sendValidationError(w, fields)
+		return
+	}
+
 	floorNumber := body.Floor
 	clientID := body.ClientId
 
-	if services.Pubsubsys.QueCapacity == services.Pubsubsys.QueLength-2 {
-		http.Error(w, "System is busy try again later", http.StatusBadRequest)
+	done, err := services.Pubsubsys.Admit(session.ID)
+	if err != nil {
+		sendError(w, err)
+		return
 	}
+	liftRequest, liftRequestResponse, err := models.CreateLiftRequest(floorNumber, body.Direction, body.To, sessionID)
+	done()
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	enqueue(liftRequest, clientID)
+	json.NewEncoder(w).Encode(liftRequestResponse)
+}
 
-	liftRequest, liftRequestResponse, err := models.CreateLiftRequest(floorNumber, sessionID)
+func CreatePassenger(w http.ResponseWriter, r *http.Request) {
+	setHeaders("POST", w)
+	var body PassengerCreateRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	if fields := body.Validate(session); len(fields) > 0 {
+		sendValidationError(w, fields)
+		return
+	}
+
+	done, err := services.Pubsubsys.Admit(session.ID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	liftRequest, passengerResponse, err := models.CreatePassenger(sessionID, body.From, body.To, body.Weight)
+	done()
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	enqueue(liftRequest, body.ClientId)
+	json.NewEncoder(w).Encode(passengerResponse)
+}
+
+// enqueue hands a request that claimed its lift to the processing loop to get
+// the lift moving.
+func enqueue(liftRequest *models.LiftRequest, createdBy primitive.ObjectID) {
+	if liftRequest != nil && liftRequest.Claimed {
+		services.Pubsubsys.AddToQue(&services.LiftRequestEvent{ID: liftRequest.ID, RequestedFloor: liftRequest.RequestedFloor, Direction: liftRequest.Direction, Destination: liftRequest.Destination, Lift: liftRequest.Lift, Status: liftRequest.Status, Session: liftRequest.Session, CreatedBy: createdBy, Claimed: true})
+	}
+}
+
+func GetPassengers(w http.ResponseWriter, r *http.Request) {
+	setHeaders("get", w)
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+	statusValue := r.URL.Query().Get("status")
+	payload, err := models.GetPassengers(sessionID, statusValue)
 	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func SetSessionSpeed(w http.ResponseWriter, r *http.Request) {
+	setHeaders("POST", w)
+	var body SessionSpeedRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		sendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	services.Pubsubsys.AddToQue(&services.LiftRequestEvent{ID: liftRequest.ID, RequestedFloor: liftRequest.RequestedFloor, Lift: liftRequest.Lift, Status: liftRequest.Status, Session: liftRequest.Session, CreatedBy: clientID})
-	json.NewEncoder(w).Encode(liftRequestResponse)
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+
+	payload, err := services.SetSessionSpeed(session.ID, body.Action, body.Multiplier, body.ClientId)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func CancelLiftRequest(w http.ResponseWriter, r *http.Request) {
+	setHeaders("del", w)
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+	clientID, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("clientId"))
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	requestID, err := models.ParseID(vars["requestId"], "request")
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	payload, err := services.CancelLiftRequest(session.ID, requestID, clientID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func AddDestination(w http.ResponseWriter, r *http.Request) {
+	setHeaders("POST", w)
+	var body DestinationCreateRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	liftID, err := models.ParseID(vars["liftId"], "lift")
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if fields := body.Validate(session); len(fields) > 0 {
+		sendValidationError(w, fields)
+		return
+	}
+
+	payload, err := services.AddDestination(session.ID, liftID, body.Floor, body.ClientId)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func SetLiftMaintenance(w http.ResponseWriter, r *http.Request) {
+	setHeaders("POST", w)
+	var body MaintenanceRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	liftID, err := models.ParseID(vars["liftId"], "lift")
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	outOfService := body.OutOfService == nil || *body.OutOfService
+
+	payload, err := services.SetLiftMaintenance(session.ID, liftID, outOfService, body.ClientId)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func SetEmergency(w http.ResponseWriter, r *http.Request) {
+	setHeaders("POST", w)
+	var body EmergencyRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	session, ok := getSession(w, sessionID)
+	if !ok {
+		return
+	}
+	if fields := body.Validate(session); len(fields) > 0 {
+		sendValidationError(w, fields)
+		return
+	}
+	active := body.Active == nil || *body.Active
+
+	payload, err := services.SetEmergency(session.ID, active, body.Floor, body.ClientId)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	setHeaders("get", w)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	payload, err := models.ListSessions(page, limit)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payload)
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	setHeaders("del", w)
+	vars := mux.Vars(r)
+	sessionID, err := models.ParseID(vars["id"], "session")
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err := services.DeleteSession(sessionID, services.SessionDeletedByUser); err != nil {
+		sendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
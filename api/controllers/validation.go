@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"github.com/ivinayakg/go-lift-simulation/utils"
+)
+
+// ValidationLimits bounds what a single session may ask for, they keep client
+// bugs from creating huge sessions on the shared server.
+type ValidationLimits struct {
+	MinFloors int
+	MaxFloors int
+	MinLifts  int
+	MaxLifts  int
+}
+
+var Limits = ValidationLimits{MinFloors: 2, MaxFloors: 100, MinLifts: 1, MaxLifts: 20}
+
+// FieldErrors maps a body field to what is wrong with it.
+type FieldErrors map[string]string
+
+func envLimit(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %v %v", name, err)
+	}
+	return limit
+}
+
+// SetupValidation reads the limits from MIN_FLOORS, MAX_FLOORS, MIN_LIFTS and
+// MAX_LIFTS, the ones not set keep their defaults.
+func SetupValidation() {
+	Limits = ValidationLimits{
+		MinFloors: envLimit("MIN_FLOORS", Limits.MinFloors),
+		MaxFloors: envLimit("MAX_FLOORS", Limits.MaxFloors),
+		MinLifts:  envLimit("MIN_LIFTS", Limits.MinLifts),
+		MaxLifts:  envLimit("MAX_LIFTS", Limits.MaxLifts),
+	}
+}
+
+func sendValidationError(w http.ResponseWriter, fields FieldErrors) {
+	sendJSONErrorResponse(w, http.StatusUnprocessableEntity, ErrorResponse{Error: "validation failed", Kind: utils.KindInvalidArgument, Fields: fields})
+}
+
+func (body *SessionCreateRequestBody) Validate() FieldErrors {
+	fields := FieldErrors{}
+	if len(body.LiftConfigs) > 0 {
+		if body.Lifts == 0 {
+			body.Lifts = len(body.LiftConfigs)
+		} else if body.Lifts != len(body.LiftConfigs) {
+			fields["lifts"] = fmt.Sprintf("is %d but liftConfigs describes %d lifts", body.Lifts, len(body.LiftConfigs))
+		}
+	}
+	minFloor, maxFloor := body.floorRange()
+	if body.MaxFloor != nil {
+		if body.Floors == 0 {
+			body.Floors = maxFloor - minFloor + 1
+		} else if body.Floors != maxFloor-minFloor+1 {
+			fields["floors"] = fmt.Sprintf("is %d but minFloor to maxFloor makes %d floors", body.Floors, maxFloor-minFloor+1)
+		}
+	}
+	if body.Floors < Limits.MinFloors || body.Floors > Limits.MaxFloors {
+		fields["floors"] = fmt.Sprintf("must be between %d and %d", Limits.MinFloors, Limits.MaxFloors)
+	}
+	if body.Lifts < Limits.MinLifts || body.Lifts > Limits.MaxLifts {
+		fields["lifts"] = fmt.Sprintf("must be between %d and %d", Limits.MinLifts, Limits.MaxLifts)
+	}
+	if body.SecondsPerFloor < 0 {
+		fields["secondsPerFloor"] = "can't be negative"
+	}
+	if body.DoorDwell < 0 {
+		fields["doorDwell"] = "can't be negative"
+	}
+	if body.Acceleration < 0 {
+		fields["acceleration"] = "can't be negative"
+	}
+	if body.Capacity.Persons < 0 {
+		fields["capacity.persons"] = "can't be negative"
+	}
+	if body.Capacity.Kg < 0 {
+		fields["capacity.kg"] = "can't be negative"
+	}
+	if body.DispatchMode != "" {
+		if err := models.ValidateDispatchMode(body.DispatchMode); err != nil {
+			fields["dispatchMode"] = err.Error()
+		}
+	}
+	if err := body.Building.Validate(body.Floors); err != nil {
+		fields["building.floorLabels"] = utils.PublicMessage(err)
+	}
+	if err := body.Faults.Validate(); err != nil {
+		fields["faults"] = utils.PublicMessage(err)
+	}
+	names := make(map[string]bool)
+	for i, liftConfig := range body.LiftConfigs {
+		validateLiftConfig(fields, fmt.Sprintf("liftConfigs[%d]", i), liftConfig, minFloor, maxFloor)
+		if liftConfig.Name != "" && names[liftConfig.Name] {
+			fields[fmt.Sprintf("liftConfigs[%d].name", i)] = "is taken by another lift"
+		}
+		names[liftConfig.Name] = true
+	}
+	return fields
+}
+
+// validateFloor checks the floor is between the lowest and highest floor, it
+// sets the field and returns false when it isn't.
+func validateFloor(fields FieldErrors, field string, floor int, minFloor int, maxFloor int) bool {
+	if floor < minFloor || floor > maxFloor {
+		fields[field] = fmt.Sprintf("must be between %d and %d", minFloor, maxFloor)
+		return false
+	}
+	return true
+}
+
+func validateLiftConfig(fields FieldErrors, prefix string, liftConfig models.LiftConfig, minFloor int, maxFloor int) {
+	if liftConfig.SecondsPerFloor < 0 {
+		fields[prefix+".secondsPerFloor"] = "can't be negative"
+	}
+	if liftConfig.Capacity.Persons < 0 {
+		fields[prefix+".capacity.persons"] = "can't be negative"
+	}
+	if liftConfig.Capacity.Kg < 0 {
+		fields[prefix+".capacity.kg"] = "can't be negative"
+	}
+	if liftConfig.StartFloor != nil {
+		validateFloor(fields, prefix+".startFloor", *liftConfig.StartFloor, minFloor, maxFloor)
+	}
+
+	served := make(map[int]bool)
+	for _, floor := range liftConfig.ServedFloors {
+		if !validateFloor(fields, prefix+".servedFloors", floor, minFloor, maxFloor) {
+			return
+		}
+		if served[floor] {
+			fields[prefix+".servedFloors"] = fmt.Sprintf("has floor %d twice", floor)
+			return
+		}
+		served[floor] = true
+	}
+	if len(served) == 1 {
+		fields[prefix+".servedFloors"] = "needs at least two floors"
+	} else if len(served) > 0 && liftConfig.StartFloor != nil && !served[*liftConfig.StartFloor] {
+		fields[prefix+".startFloor"] = "must be one of the served floors"
+	}
+}
+
+func (body *LiftRequestCreateRequestBody) Validate(session *models.Session) FieldErrors {
+	fields := FieldErrors{}
+	if body.From != nil {
+		body.Floor = *body.From
+	}
+	if session.DispatchMode == models.DispatchDestination {
+		return body.validateDestination(session, fields)
+	}
+
+	if body.To != nil {
+		fields["to"] = "is only taken by destination dispatch sessions"
+	}
+	if validateFloor(fields, "floor", body.Floor, session.MinFloor, session.MaxFloor) && body.Direction != "" {
+		if err := models.ValidateCallDirection(body.Direction, body.Floor, session.MinFloor, session.MaxFloor); err != nil {
+			fields["direction"] = err.Error()
+		}
+	}
+	return fields
+}
+
+// validateDestination checks the trip keyed in at the hall of a destination
+// dispatch session, the direction follows from it.
+func (body *LiftRequestCreateRequestBody) validateDestination(session *models.Session, fields FieldErrors) FieldErrors {
+	validateFloor(fields, "from", body.Floor, session.MinFloor, session.MaxFloor)
+	if body.To == nil {
+		fields["to"] = "is required in destination dispatch sessions"
+	} else if validateFloor(fields, "to", *body.To, session.MinFloor, session.MaxFloor) && *body.To == body.Floor {
+		fields["to"] = "must be another floor than from"
+	}
+	if body.Direction != "" {
+		fields["direction"] = "follows from the destination in destination dispatch sessions"
+	}
+	return fields
+}
+
+func (body *PassengerCreateRequestBody) Validate(session *models.Session) FieldErrors {
+	fields := FieldErrors{}
+	validateFloor(fields, "from", body.From, session.MinFloor, session.MaxFloor)
+	if validateFloor(fields, "to", body.To, session.MinFloor, session.MaxFloor) && body.To == body.From {
+		fields["to"] = "must be another floor than from"
+	}
+	weight := body.Weight
+	if weight == 0 {
+		weight = models.DefaultPassengerWeight
+	}
+	if body.Weight < 0 {
+		fields["weight"] = "can't be negative"
+	} else if maxKg := maxLiftKg(session); maxKg > 0 && weight > maxKg {
+		fields["weight"] = fmt.Sprintf("is more than any lift carries, the most is %v kg", maxKg)
+	}
+	return fields
+}
+
+// maxLiftKg is the most weight a lift of the session carries, 0 when some lift
+// has no kg limit.
+func maxLiftKg(session *models.Session) float64 {
+	maxKg := 0.0
+	for _, lift := range session.Lifts {
+		if lift.Capacity.Kg <= 0 {
+			return 0
+		}
+		if lift.Capacity.Kg > maxKg {
+			maxKg = lift.Capacity.Kg
+		}
+	}
+	return maxKg
+}
+
+func (body *DestinationCreateRequestBody) Validate(session *models.Session) FieldErrors {
+	fields := FieldErrors{}
+	validateFloor(fields, "floor", body.Floor, session.MinFloor, session.MaxFloor)
+	return fields
+}
+
+func (body *EmergencyRequestBody) Validate(session *models.Session) FieldErrors {
+	fields := FieldErrors{}
+	if body.Floor != nil {
+		validateFloor(fields, "floor", *body.Floor, session.MinFloor, session.MaxFloor)
+	}
+	return fields
+}
+
+// getSession loads the session of the url, it answers the request itself and
+// returns false when the session can't be loaded.
+func getSession(w http.ResponseWriter, sessionID string) (*models.Session, bool) {
+	session, err := models.GetSession(sessionID)
+	if err != nil {
+		sendError(w, err)
+		return nil, false
+	}
+	return session, true
+}
@@ -0,0 +1,164 @@
+package dispatcher
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+	DirectionNone = "none"
+)
+
+const (
+	StrategyNearest   = "nearest"
+	StrategyFirstIdle = "first_idle"
+)
+
+// Car is the view of a lift the dispatcher scores.
+type Car struct {
+	ID        primitive.ObjectID
+	Floor     int
+	Direction string
+	// Load is the number of stops the car has to serve before it is free.
+	Load int
+	// Stops are the floors the car already has to stop on.
+	Stops []int
+	// Timing of the car when it moves at its own pace, the one given to Assign
+	// is used otherwise.
+	Timing    Timing
+	Available bool
+}
+
+// Call is a hall call waiting for a car, Direction is the way the passenger
+// wants to go. Destination is set when the passenger keyed in the floor at the
+// hall, as with destination dispatch.
+type Call struct {
+	Floor       int
+	Direction   string
+	Destination *int
+}
+
+type Assignment struct {
+	Car   primitive.ObjectID
+	Score float64
+	ETA   time.Duration
+}
+
+// Timing tells the dispatcher how long the cars of a session need to travel and
+// to stop, it is used for the ETA of an assignment.
+type Timing interface {
+	TravelDuration(floors int) time.Duration
+	DoorDuration() time.Duration
+}
+
+type Dispatcher interface {
+	// Assign picks a car for the call, it returns false when no car can take it.
+	Assign(call Call, cars []Car, timing Timing) (*Assignment, bool)
+}
+
+// eta is the time the car needs to reach the call, every stop it still has to
+// serve on the way costs a door cycle.
+func eta(call Call, car Car, timing Timing) time.Duration {
+	if car.Timing != nil {
+		timing = car.Timing
+	}
+	return timing.TravelDuration(call.Floor-car.Floor) + time.Duration(car.Load)*timing.DoorDuration()
+}
+
+// NearestCar scores every available car by the floors it has to travel to reach
+// the call, penalising cars heading away from it and cars with pending stops
+// and favouring cars already stopping where a destination call boards or goes.
+type NearestCar struct {
+	// DirectionPenalty is added, in floors, when the car moves away from the call
+	// and again when it travels the other way than the passenger wants to go.
+	DirectionPenalty float64
+	// LoadPenalty is added, in floors, for every stop the car still has to serve.
+	LoadPenalty float64
+	// GroupBonus is taken off, in floors, for every stop of the call the car
+	// already makes, grouping passengers going to the same floors in one car.
+	GroupBonus float64
+}
+
+func NewNearestCar() *NearestCar {
+	return &NearestCar{DirectionPenalty: 2, LoadPenalty: 1, GroupBonus: 2}
+}
+
+func (d *NearestCar) Assign(call Call, cars []Car, timing Timing) (*Assignment, bool) {
+	var best *Assignment
+	for _, car := range cars {
+		if !car.Available {
+			continue
+		}
+		score := d.score(call, car)
+		if best == nil || score < best.Score {
+			best = &Assignment{Car: car.ID, Score: score, ETA: eta(call, car, timing)}
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best, true
+}
+
+func (d *NearestCar) score(call Call, car Car) float64 {
+	distance := math.Abs(float64(call.Floor - car.Floor))
+	score := distance
+
+	switch car.Direction {
+	case DirectionUp:
+		if call.Floor < car.Floor {
+			score += d.DirectionPenalty
+		}
+	case DirectionDown:
+		if call.Floor > car.Floor {
+			score += d.DirectionPenalty
+		}
+	}
+	if car.Direction != "" && car.Direction != DirectionNone && call.Direction != "" && car.Direction != call.Direction {
+		score += d.DirectionPenalty
+	}
+
+	score += float64(car.Load) * d.LoadPenalty
+
+	if call.Destination != nil {
+		for _, stop := range car.Stops {
+			if stop == call.Floor || stop == *call.Destination {
+				score -= d.GroupBonus
+			}
+		}
+	}
+	return score
+}
+
+// FirstIdle hands the call to the first available car, it is the behaviour the
+// simulation had before the dispatcher existed.
+type FirstIdle struct{}
+
+func (d *FirstIdle) Assign(call Call, cars []Car, timing Timing) (*Assignment, bool) {
+	for _, car := range cars {
+		if car.Available {
+			distance := math.Abs(float64(call.Floor - car.Floor))
+			return &Assignment{Car: car.ID, Score: distance, ETA: eta(call, car, timing)}, true
+		}
+	}
+	return nil, false
+}
+
+// New returns the dispatcher for the strategy name, an empty name gives the
+// default nearest car strategy.
+func New(strategy string) (Dispatcher, error) {
+	switch strings.ToLower(strategy) {
+	case StrategyNearest, "":
+		return NewNearestCar(), nil
+	case StrategyFirstIdle:
+		return &FirstIdle{}, nil
+	default:
+		return nil, fmt.Errorf("invalid dispatch strategy %v, valid strategies are %v, %v", strategy, StrategyNearest, StrategyFirstIdle)
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/ivinayakg/go-lift-simulation/services"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func main() {
@@ -37,30 +36,52 @@ func main() {
 	allowed_origins := strings.Split(os.Getenv("ALLOWED_ORIGINS"), " ")
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: allowed_origins,
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"Retry-After"},
 	})
 	fmt.Println(allowed_origins)
 
 	models.CreateDBInstance()
+	models.SetupDispatcher()
+	controllers.SetupValidation()
 	services.SetupPubSub()
 
 	router.HandleFunc("/session", controllers.CreateSession).Methods("POST", "OPTIONS")
+	router.HandleFunc("/sessions", controllers.ListSessions).Methods("GET", "OPTIONS")
 	router.HandleFunc("/session/{id}", controllers.GetSession).Methods("GET", "OPTIONS")
+	router.HandleFunc("/session/{id}", controllers.DeleteSession).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/session/{id}/request", controllers.CreateLiftRequest).Methods("POST", "OPTIONS")
 	router.HandleFunc("/session/{id}/request/", controllers.GetLiftRequests).Methods("GET", "OPTIONS")
+	router.HandleFunc("/session/{id}/request/{requestId}", controllers.CancelLiftRequest).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/session/{id}/lift/{liftId}/destination", controllers.AddDestination).Methods("POST", "OPTIONS")
+	router.HandleFunc("/session/{id}/lift/{liftId}/maintenance", controllers.SetLiftMaintenance).Methods("POST", "OPTIONS")
+	router.HandleFunc("/session/{id}/passenger", controllers.CreatePassenger).Methods("POST", "OPTIONS")
+	router.HandleFunc("/session/{id}/passenger/", controllers.GetPassengers).Methods("GET", "OPTIONS")
+	router.HandleFunc("/session/{id}/emergency", controllers.SetEmergency).Methods("POST", "OPTIONS")
+	router.HandleFunc("/session/{id}/speed", controllers.SetSessionSpeed).Methods("POST", "OPTIONS")
 	pool := services.DeployWS(router)
 
 	routerProtected := corsHandler.Handler(router)
 
+	if ttl := os.Getenv("SESSION_IDLE_TTL"); ttl != "" {
+		sessionTTL, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatal("Invalid SESSION_IDLE_TTL ", err)
+		}
+		reapInterval := time.Minute
+		if interval := os.Getenv("SESSION_REAP_INTERVAL"); interval != "" {
+			if reapInterval, err = time.ParseDuration(interval); err != nil {
+				log.Fatal("Invalid SESSION_REAP_INTERVAL ", err)
+			}
+		}
+		services.StartReaper(sessionTTL, reapInterval)
+	}
+
 	go services.Pubsubsys.ProcessRequests(func(lr *services.LiftRequestEvent) {
-		pool.Broadcast <- &services.Message{SessionID: lr.Session, Body: bson.M{"event": services.SocketEvents["Lift Moved"], "floor_requested": lr.RequestedFloor, "lift_id": lr.Lift}, CreatedBy: lr.CreatedBy}
-		go func() {
-			time.Sleep(10 * time.Second)
-			requestObject := &models.LiftRequest{ID: lr.ID, RequestedFloor: lr.RequestedFloor, Lift: lr.Lift, Status: lr.Status, Session: lr.Session}
-			models.CompleteLiftRequest(requestObject)
-		}()
+		services.RunTrip(pool, lr)
 	})
+	services.RecoverLifts(pool)
 
 	fmt.Println("Starting the server on port " + PORT)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", PORT), routerProtected))
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+)
+
+// SessionConfig describes the building and lifts of a session to create.
+type SessionConfig struct {
+	// Floors is how many floors the building has, numbered up from MinFloor.
+	Floors       int
+	MinFloor     int
+	Kinematics   Kinematics
+	DispatchMode string
+	Building     Building
+	Faults       FaultConfig
+	Lifts        []LiftConfig
+}
+
+// Building holds the details of the building a session simulates.
+type Building struct {
+	// FloorLabels names the floors from the lowest up, like "B1", "G" or "M".
+	// Floors are numbered when it is left out.
+	FloorLabels []string `json:"floorLabels,omitempty"`
+}
+
+// LiftConfig describes a single lift, the fields left out fall back to the
+// session wide settings.
+type LiftConfig struct {
+	Name string `json:"name"`
+	// SecondsPerFloor is the cruising pace of this lift.
+	SecondsPerFloor float64  `json:"secondsPerFloor"`
+	Capacity        Capacity `json:"capacity"`
+	// StartFloor defaults to the ground floor, or the lowest floor the lift
+	// serves when it doesn't serve the ground floor.
+	StartFloor *int `json:"startFloor"`
+	// ServedFloors are the floors the lift stops on, every floor when empty.
+	ServedFloors []int `json:"servedFloors"`
+}
+
+// Validate checks the floor labels of a building with the given floors.
+func (building Building) Validate(floors int) error {
+	if len(building.FloorLabels) == 0 {
+		return nil
+	}
+	if len(building.FloorLabels) != floors {
+		return utils.InvalidArgument("floorLabels needs a label for each of the %d floors", floors)
+	}
+	seen := make(map[string]bool)
+	for _, label := range building.FloorLabels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return utils.InvalidArgument("floorLabels can't have an empty label")
+		}
+		if seen[label] {
+			return utils.InvalidArgument("floorLabels has %q twice", label)
+		}
+		seen[label] = true
+	}
+	return nil
+}
+
+// forLift is the kinematics of the session with the pace of the lift.
+func (k Kinematics) forLift(lift *Lift) Kinematics {
+	if lift != nil && lift.SecondsPerFloor > 0 {
+		k.SecondsPerFloor = lift.SecondsPerFloor
+	}
+	return k
+}
+
+// startFloor is the floor the lift waits on when the session starts.
+func (liftConfig LiftConfig) startFloor(minFloor int, maxFloor int, servedFloors []int) int {
+	if liftConfig.StartFloor != nil {
+		return *liftConfig.StartFloor
+	}
+	lift := Lift{ServedFloors: servedFloors}
+	if minFloor <= 0 && maxFloor >= 0 && lift.servesFloor(0) {
+		return 0
+	}
+	if len(servedFloors) > 0 {
+		return servedFloors[0]
+	}
+	return minFloor
+}
+
+func CreateSession(config SessionConfig) (*Session, error) {
+	if err := config.Kinematics.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Building.Validate(config.Floors); err != nil {
+		return nil, err
+	}
+	if err := config.Faults.Validate(); err != nil {
+		return nil, err
+	}
+
+	minFloor, maxFloor := config.MinFloor, config.MinFloor+config.Floors-1
+	var liftObjs []Lift
+	for _, liftConfig := range config.Lifts {
+		servedFloors := append([]int(nil), liftConfig.ServedFloors...)
+		sort.Ints(servedFloors)
+		liftObjs = append(liftObjs, Lift{
+			Name:            liftConfig.Name,
+			CurrentFloor:    liftConfig.startFloor(minFloor, maxFloor, servedFloors),
+			Status:          StatusIdle,
+			Direction:       DirectionNone,
+			DoorState:       DoorClosed,
+			SecondsPerFloor: liftConfig.SecondsPerFloor,
+			Capacity:        liftConfig.Capacity,
+			ServedFloors:    servedFloors,
+		})
+	}
+
+	dispatchMode := config.DispatchMode
+	if dispatchMode == "" {
+		dispatchMode = DispatchConventional
+	}
+	sessionDoc := SessionDocument{Floors: config.Floors, MinFloor: minFloor, MaxFloor: maxFloor, Kinematics: config.Kinematics.withDefaults(), DispatchMode: strings.ToLower(dispatchMode), Building: config.Building, Faults: config.Faults.withDefaults(), LastActivity: time.Now()}
+	return db.CreateSession(sessionDoc, liftObjs)
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"log"
+	"os"
+
+	"github.com/ivinayakg/go-lift-simulation/dispatcher"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var liftDispatcher dispatcher.Dispatcher = dispatcher.NewNearestCar()
+
+func SetupDispatcher() {
+	strategy, err := dispatcher.New(os.Getenv("DISPATCH_STRATEGY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	liftDispatcher = strategy
+}
+
+// dispatchCars builds the dispatcher view of the session lifts. Besides the idle
+// ones, a lift heading the way of the call that hasn't passed its floor yet
+// can stop for it on the way, unless it is full. Only lifts serving the floor
+// of the call, and its destination or one of the destinations of the
+// passengers waiting on it, can take it.
+func dispatchCars(session *Session, activeRequests []*LiftRequest, call dispatcher.Call, destinations []int) []dispatcher.Car {
+	load := make(map[primitive.ObjectID]int)
+	stops := make(map[primitive.ObjectID][]int)
+	for _, liftRequest := range activeRequests {
+		load[liftRequest.Lift]++
+		stops[liftRequest.Lift] = append(stops[liftRequest.Lift], liftRequest.RequestedFloor)
+		if liftRequest.Destination != nil {
+			stops[liftRequest.Lift] = append(stops[liftRequest.Lift], *liftRequest.Destination)
+		}
+	}
+
+	cars := make([]dispatcher.Car, 0, len(session.Lifts))
+	for _, lift := range session.Lifts {
+		car := dispatcher.Car{
+			ID:        lift.ID,
+			Floor:     lift.CurrentFloor,
+			Load:      load[lift.ID],
+			Stops:     stops[lift.ID],
+			Timing:    session.Kinematics.forLift(&lift),
+			Available: lift.Status == StatusIdle,
+		}
+		if lift.Status != StatusIdle {
+			car.Direction = lift.Direction
+			car.Available = call.Direction == lift.Direction && isAhead(call.Floor, lift.CurrentFloor, lift.Direction)
+		}
+		if !lift.takesHallCalls() || !lift.servesFloor(call.Floor) || !lift.servesAny(destinations) {
+			car.Available = false
+		}
+		if call.Destination != nil && !lift.servesFloor(*call.Destination) {
+			car.Available = false
+		}
+		cars = append(cars, car)
+	}
+	return cars
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Emergency is the fire service recall of a session. While it is active every
+// lift heads straight to the evacuation floor and lets everyone out there, the
+// requests made before are recalled and no new ones are taken.
+type Emergency struct {
+	Active bool       `json:"active"`
+	Floor  int        `json:"floor"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+var ErrEmergencyRecall = utils.Conflict("Lifts are recalled for an emergency, no calls are taken")
+
+// checkNoEmergency fails while the lifts of the session are recalled.
+func (session *Session) checkNoEmergency() error {
+	if session.Emergency.Active {
+		return ErrEmergencyRecall
+	}
+	return nil
+}
+
+// evacuationFloor is where the lifts are recalled to when no floor is given,
+// the ground floor or the lowest one of a building without it.
+func (session *Session) evacuationFloor() int {
+	if session.HasFloor(0) {
+		return 0
+	}
+	return session.MinFloor
+}
+
+// SetEmergency starts or clears the fire service recall of the session. On
+// start every queued and pending request is recalled and the waiting
+// passengers are evacuated, the recalled requests are returned.
+func SetEmergency(sessionID primitive.ObjectID, active bool, floor *int) (*Emergency, []*LiftRequest, error) {
+	session, err := db.GetSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	TouchSession(session.ID)
+
+	emergency := Emergency{}
+	if active {
+		now := time.Now()
+		emergency = Emergency{Active: true, Floor: session.evacuationFloor(), Since: &now}
+		if floor != nil {
+			emergency.Floor = *floor
+		}
+		if !session.HasFloor(emergency.Floor) {
+			return nil, nil, utils.InvalidArgument("floor must be between %d and %d", session.MinFloor, session.MaxFloor)
+		}
+		if err := session.checkFloorServed(emergency.Floor); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := db.SetEmergency(session.ID, emergency); err != nil {
+		return nil, nil, err
+	}
+	if !active {
+		return &emergency, nil, nil
+	}
+
+	var recalled []*LiftRequest
+	for _, status := range []string{StatusQueued, StatusPending} {
+		activeRequests, err := db.GetLiftRequests(session.ID, status)
+		if err != nil {
+			return nil, recalled, err
+		}
+		for _, liftRequest := range activeRequests {
+			if err := db.RecallLiftRequest(liftRequest); err != nil {
+				if err == ErrLiftRequestNotActive {
+					continue
+				}
+				return nil, recalled, err
+			}
+			liftRequest.Status = StatusRecalled
+			recalled = append(recalled, liftRequest)
+		}
+	}
+
+	waiting, err := db.GetPassengers(session.ID, PassengerWaiting)
+	if err != nil {
+		return nil, recalled, err
+	}
+	for _, passenger := range waiting {
+		passenger.Status = PassengerEvacuated
+		if err := db.UpdatePassenger(passenger); err != nil {
+			return nil, recalled, err
+		}
+	}
+	return &emergency, recalled, nil
+}
+
+// recallTrip is the trip of a recalled lift, straight to the evacuation floor.
+// A lift already there only opens its doors when someone is still inside.
+func (session *Session) recallTrip(lift *Lift) *Trip {
+	floor := session.Emergency.Floor
+	if lift.CurrentFloor == floor && lift.Passengers == 0 {
+		return nil
+	}
+	heading := headingTowards(lift.CurrentFloor, floor)
+	if heading == DirectionNone {
+		heading = lift.Direction
+	}
+	kinematics := session.Kinematics.forLift(lift)
+	trip := &Trip{Lift: lift.ID, FromFloor: lift.CurrentFloor, ToFloor: floor, Heading: heading, Door: kinematics.DoorDuration()}
+	trip.Travel = kinematics.TravelDuration(trip.ToFloor - trip.FromFloor)
+	trip.FloorOffsets = kinematics.FloorOffsets(trip.ToFloor - trip.FromFloor)
+	return trip
+}
+
+// evacuate lets every rider of the lift out on the evacuation floor.
+func evacuate(lift *Lift, arrival *Arrival) error {
+	riders, err := db.GetLiftPassengers(lift.ID)
+	if err != nil {
+		return err
+	}
+	for _, rider := range riders {
+		rider.Status = PassengerEvacuated
+		if err := db.UpdatePassenger(rider); err != nil {
+			return err
+		}
+		lift.Passengers--
+		lift.Load -= rider.Weight
+		arrival.Alighted = append(arrival.Alighted, rider)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	FaultBreakdown = "breakdown"
+	FaultStuck     = "stuck"
+	FaultDoorJam   = "door_jam"
+)
+
+const (
+	DefaultBreakdownRepair = 30
+	DefaultStuckRepair     = 20
+	DefaultDoorJamDelay    = 5
+)
+
+// FaultConfig makes the lifts of a session fail at random, to see how dispatch
+// copes. Every chance is rolled once per trip, from 0 for never to 1 for every
+// trip, and every fault lasts its repair time in seconds. A breakdown keeps the
+// lift from setting off, a stuck lift stops between two floors on its way and
+// jammed doors stay open longer at the stop. The repair times left out get
+// their defaults, one set to 0 is kept.
+type FaultConfig struct {
+	// Seed makes the faults of the session the same on every run, one is picked
+	// when it is left out.
+	Seed            *int64   `json:"seed,omitempty"`
+	BreakdownChance float64  `json:"breakdownChance"`
+	BreakdownRepair *float64 `json:"breakdownRepair,omitempty"`
+	StuckChance     float64  `json:"stuckChance"`
+	StuckRepair     *float64 `json:"stuckRepair,omitempty"`
+	DoorJamChance   float64  `json:"doorJamChance"`
+	DoorJamDelay    *float64 `json:"doorJamDelay,omitempty"`
+}
+
+// Fault is a failure of a lift on a trip, At is when it strikes after the trip
+// started and Repair how long the lift is held up.
+type Fault struct {
+	Kind   string
+	Floor  int
+	At     time.Duration
+	Repair time.Duration
+}
+
+// HistoryEntry is something that happened to a request on its way, like a
+// fault of its lift.
+type HistoryEntry struct {
+	Event string             `json:"event"`
+	Lift  primitive.ObjectID `json:"lift"`
+	Floor int                `json:"floor"`
+	// Duration is how long the event held the request up, in seconds.
+	Duration float64   `json:"duration"`
+	Time     time.Time `json:"time"`
+}
+
+func (config FaultConfig) enabled() bool {
+	return config.BreakdownChance > 0 || config.StuckChance > 0 || config.DoorJamChance > 0
+}
+
+// withDefaults fills the repair times left out and picks a seed.
+func (config FaultConfig) withDefaults() FaultConfig {
+	if config.BreakdownRepair == nil {
+		config.BreakdownRepair = floatOf(DefaultBreakdownRepair)
+	}
+	if config.StuckRepair == nil {
+		config.StuckRepair = floatOf(DefaultStuckRepair)
+	}
+	if config.DoorJamDelay == nil {
+		config.DoorJamDelay = floatOf(DefaultDoorJamDelay)
+	}
+	if config.Seed == nil && config.enabled() {
+		seed := time.Now().UnixNano()
+		config.Seed = &seed
+	}
+	return config
+}
+
+func floatOf(value float64) *float64 {
+	return &value
+}
+
+// Validate reports the first invalid field, in the order they are declared, so
+// the same config always gets the same error.
+func (config FaultConfig) Validate() error {
+	chances := []struct {
+		name  string
+		value float64
+	}{
+		{"breakdownChance", config.BreakdownChance},
+		{"stuckChance", config.StuckChance},
+		{"doorJamChance", config.DoorJamChance},
+	}
+	for _, chance := range chances {
+		if chance.value < 0 || chance.value > 1 {
+			return utils.InvalidArgument("%v must be between 0 and 1", chance.name)
+		}
+	}
+	durations := []struct {
+		name  string
+		value *float64
+	}{
+		{"breakdownRepair", config.BreakdownRepair},
+		{"stuckRepair", config.StuckRepair},
+		{"doorJamDelay", config.DoorJamDelay},
+	}
+	for _, duration := range durations {
+		if duration.value != nil && *duration.value < 0 {
+			return utils.InvalidArgument("%v can't be negative", duration.name)
+		}
+	}
+	return nil
+}
+
+// FaultInjector rolls the faults of the trips of a session, the rolls follow
+// from the seed so a session replayed with the same seed fails the same way.
+type FaultInjector struct {
+	mu     sync.Mutex
+	config FaultConfig
+	rng    *rand.Rand
+}
+
+func NewFaultInjector(config FaultConfig) *FaultInjector {
+	config = config.withDefaults()
+	injector := &FaultInjector{config: config}
+	if config.Seed != nil {
+		injector.rng = rand.New(rand.NewSource(*config.Seed))
+	}
+	return injector
+}
+
+// Inject rolls the faults of the trip and holds the trip up for their repairs.
+func (injector *FaultInjector) Inject(trip *Trip) {
+	if injector == nil || !injector.config.enabled() {
+		return
+	}
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	config := injector.config
+
+	if injector.rng.Float64() < config.BreakdownChance {
+		repair := seconds(*config.BreakdownRepair)
+		trip.Faults = append(trip.Faults, Fault{Kind: FaultBreakdown, Floor: trip.FromFloor, Repair: repair})
+		trip.Departure += repair
+		trip.Travel += repair
+	}
+	if injector.rng.Float64() < config.StuckChance && len(trip.FloorOffsets) > 0 {
+		// The lift gets stuck halfway to one of the floors on its way.
+		next := injector.rng.Intn(len(trip.FloorOffsets))
+		var previous time.Duration
+		if next > 0 {
+			previous = trip.FloorOffsets[next-1]
+		}
+		repair := seconds(*config.StuckRepair)
+		floor := trip.FromFloor + next
+		if trip.Direction() == DirectionDown {
+			floor = trip.FromFloor - next
+		}
+		trip.Faults = append(trip.Faults, Fault{Kind: FaultStuck, Floor: floor, At: trip.Departure + (previous+trip.FloorOffsets[next])/2, Repair: repair})
+		for i := next; i < len(trip.FloorOffsets); i++ {
+			trip.FloorOffsets[i] += repair
+		}
+		trip.Travel += repair
+	}
+	if injector.rng.Float64() < config.DoorJamChance {
+		trip.DoorJam = seconds(*config.DoorJamDelay)
+		trip.Door += trip.DoorJam
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// RecordFault adds the fault to the history of every request the lift is
+// serving, they all wait for the repair.
+func RecordFault(liftID primitive.ObjectID, fault Fault) error {
+	entry := HistoryEntry{Event: fault.Kind, Lift: liftID, Floor: fault.Floor, Duration: fault.Repair.Seconds(), Time: time.Now()}
+	return db.RecordLiftHistory(liftID, entry)
+}
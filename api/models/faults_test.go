@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+)
+
+func TestFaultConfigValidateOrder(t *testing.T) {
+	config := FaultConfig{BreakdownChance: 2, StuckChance: -1, DoorJamChance: 3, BreakdownRepair: floatOf(-1)}
+	for i := 0; i < 20; i++ {
+		err := config.Validate()
+		if message := utils.PublicMessage(err); message != "breakdownChance must be between 0 and 1" {
+			t.Fatalf("got %q, want the first field reported", message)
+		}
+	}
+
+	config = FaultConfig{StuckRepair: floatOf(-1), DoorJamDelay: floatOf(-1)}
+	if message := utils.PublicMessage(config.Validate()); message != "stuckRepair can't be negative" {
+		t.Fatalf("got %q, want stuckRepair reported", message)
+	}
+}
+
+func TestFaultConfigKeepsZeroRepair(t *testing.T) {
+	config := FaultConfig{BreakdownChance: 1, BreakdownRepair: floatOf(0)}.withDefaults()
+	if *config.BreakdownRepair != 0 {
+		t.Fatalf("breakdown repair is %v, want the 0 that was set", *config.BreakdownRepair)
+	}
+	if *config.StuckRepair != DefaultStuckRepair || *config.DoorJamDelay != DefaultDoorJamDelay {
+		t.Fatalf("repairs left out are %v and %v, want the defaults", *config.StuckRepair, *config.DoorJamDelay)
+	}
+
+	trip := &Trip{FromFloor: 0, ToFloor: 3}
+	NewFaultInjector(config).Inject(trip)
+	if len(trip.Faults) != 1 || trip.Faults[0].Repair != 0 || trip.Departure != 0 {
+		t.Fatalf("trip got faults %v departing after %v, want one breakdown without delay", trip.Faults, trip.Departure)
+	}
+}
@@ -1,18 +1,15 @@
 package models
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/ivinayakg/go-lift-simulation/dispatcher"
 	"github.com/ivinayakg/go-lift-simulation/utils"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // type User struct {
@@ -24,248 +21,526 @@ import (
 
 type Lift struct {
 	ID           primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Name         string             `json:"name,omitempty"`
 	CurrentFloor int                `json:"currentFloor"`
 	Status       string             `json:"status,omitempty"`
+	Direction    string             `json:"direction"`
+	DoorState    string             `json:"doorState"`
+	Capacity     Capacity           `json:"capacity"`
+	// Passengers is the number of people riding the lift and Load their weight
+	// in kg.
+	Passengers int     `json:"passengers"`
+	Load       float64 `json:"load"`
+	// SecondsPerFloor overrides the pace of the session for this lift.
+	SecondsPerFloor float64 `json:"secondsPerFloor,omitempty"`
+	// ServedFloors are the floors the lift stops on, every floor when empty.
+	ServedFloors []int `json:"servedFloors,omitempty"`
+	// Maintenance takes the lift out of rotation, it drops its riders off and
+	// parks out_of_service.
+	Maintenance bool `json:"maintenance"`
+	// SavedAt is the virtual time of the session when the state of the lift
+	// was last saved, a restart finds out from it how long the lift has been at
+	// its stop.
+	SavedAt time.Duration `json:"savedAt"`
 }
 
 type Session struct {
 	ID     primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
 	Lifts  []Lift             `json:"lifts"`
 	Floors int                `json:"floors"`
+	// MinFloor and MaxFloor are the lowest and highest floor numbers, floors
+	// below 0 are basements.
+	MinFloor   int        `json:"minFloor"`
+	MaxFloor   int        `json:"maxFloor"`
+	Kinematics Kinematics `json:"kinematics"`
+	// DispatchMode is conventional, up and down hall buttons, or destination,
+	// passengers key in their destination at the hall.
+	DispatchMode string      `json:"dispatchMode"`
+	Building     Building    `json:"building"`
+	Faults       FaultConfig `json:"faults"`
+	Emergency    Emergency   `json:"emergency"`
+	LastActivity time.Time   `json:"lastActivity"`
 }
 
 type SessionDocument struct {
-	ID     primitive.ObjectID   `json:"_id,omitempty"  bson:"_id,omitempty"`
-	Lifts  []primitive.ObjectID `json:"lifts"`
-	Floors int                  `json:"floors"`
+	ID           primitive.ObjectID   `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Lifts        []primitive.ObjectID `json:"lifts"`
+	Floors       int                  `json:"floors"`
+	MinFloor     int                  `json:"minFloor"`
+	MaxFloor     int                  `json:"maxFloor"`
+	Kinematics   Kinematics           `json:"kinematics"`
+	DispatchMode string               `json:"dispatchMode"`
+	Building     Building             `json:"building"`
+	Faults       FaultConfig          `json:"faults"`
+	Emergency    Emergency            `json:"emergency"`
+	LastActivity time.Time            `json:"lastActivity"`
+}
+
+// toSession joins the session document with its lifts.
+func (sessionDoc *SessionDocument) toSession(lifts []Lift) *Session {
+	minFloor, maxFloor := sessionDoc.floorRange()
+	return &Session{ID: sessionDoc.ID, Floors: sessionDoc.Floors, MinFloor: minFloor, MaxFloor: maxFloor, Lifts: lifts, Kinematics: sessionDoc.Kinematics.withDefaults(), DispatchMode: sessionDoc.dispatchMode(), Building: sessionDoc.Building, Faults: sessionDoc.Faults, Emergency: sessionDoc.Emergency, LastActivity: sessionDoc.LastActivity}
+}
+
+// floorRange defaults sessions stored before signed floors existed to floors 0
+// up to Floors-1, no building has a single floor.
+func (sessionDoc *SessionDocument) floorRange() (int, int) {
+	if sessionDoc.MinFloor == 0 && sessionDoc.MaxFloor == 0 {
+		return 0, sessionDoc.Floors - 1
+	}
+	return sessionDoc.MinFloor, sessionDoc.MaxFloor
+}
+
+// dispatchMode defaults sessions stored before dispatch modes existed to
+// conventional.
+func (sessionDoc *SessionDocument) dispatchMode() string {
+	if sessionDoc.DispatchMode == "" {
+		return DispatchConventional
+	}
+	return sessionDoc.DispatchMode
+}
+
+type SessionList struct {
+	Sessions []*Session `json:"sessions"`
+	Page     int        `json:"page"`
+	Limit    int        `json:"limit"`
+	Total    int64      `json:"total"`
 }
 
 type LiftRequest struct {
 	ID             primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
 	RequestedFloor int                `json:"requestedFloor"`
-	Lift           primitive.ObjectID `json:"lift"`
-	Status         string             `json:"status,omitempty"`
-	Session        primitive.ObjectID `json:"session"`
+	// Direction is the way the passenger of a hall call wants to go, up or down.
+	Direction string `json:"direction"`
+	// Destination is the floor the passenger keyed in at the hall, only hall
+	// calls of destination dispatch sessions have one.
+	Destination *int `json:"destination,omitempty"`
+	// Type tells hall calls, made from a floor, from car calls, made inside a
+	// lift to pick a destination.
+	Type    string             `json:"type"`
+	Lift    primitive.ObjectID `json:"lift"`
+	Status  string             `json:"status,omitempty"`
+	Session primitive.ObjectID `json:"session"`
+	// Active is set while the request is queued or pending, a session has at
+	// most one active hall call per floor, direction and destination and a lift
+	// at most one car call per floor.
+	Active bool `json:"-"`
+	// Claimed is set on a request that just claimed its idle lift, whoever made
+	// the request has to get the lift moving.
+	Claimed bool `json:"-" bson:"-"`
+	// History holds what happened to the request on its way, like the faults
+	// of its lift.
+	History []HistoryEntry `json:"history,omitempty"`
+	// CreatedAt is when the request was made.
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type LiftRequestResponse struct {
 	ID             primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
 	RequestedFloor int                `json:"requestedFloor"`
-	Lift           Lift               `json:"lift"`
-	Status         string             `json:"status,omitempty"`
-	Session        primitive.ObjectID `json:"session"`
+	Direction      string             `json:"direction"`
+	Destination    *int               `json:"destination,omitempty"`
+	// Transfer is set when no lift goes to the destination keyed in, the lift
+	// takes the passenger to Destination, a sky lobby, to call another one.
+	Transfer bool   `json:"transfer,omitempty"`
+	Type     string `json:"type"`
+	// Lift is the lift to board, it is empty while the request is pending.
+	Lift    Lift               `json:"lift"`
+	Status  string             `json:"status,omitempty"`
+	Session primitive.ObjectID `json:"session"`
+	// ETA is the number of seconds the dispatcher expects the lift to need to reach the floor.
+	ETA float64 `json:"eta"`
 }
 
+// A lift is idle, moving towards its next stop or standing at one with its
+// doors open. Any status but idle means the lift is claimed by its stops, or
+// parked out of service under maintenance.
+const (
+	StatusIdle         = "idle"
+	StatusMovingUp     = "moving_up"
+	StatusMovingDown   = "moving_down"
+	StatusDoorsOpen    = "doors_open"
+	StatusOutOfService = "out_of_service"
+)
+
 const (
-	StatusIdle      = "idle"
-	StatusBusy      = "busy"
 	StatusQueued    = "queued"
+	StatusPending   = "pending"
 	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	// StatusRecalled is the status of the requests called off by an emergency
+	// recall.
+	StatusRecalled = "recalled"
+)
+
+const (
+	DirectionUp   = dispatcher.DirectionUp
+	DirectionDown = dispatcher.DirectionDown
+	DirectionNone = dispatcher.DirectionNone
+)
+
+const (
+	RequestHall = "hall"
+	RequestCar  = "car"
+)
+
+const (
+	DoorOpen   = "open"
+	DoorClosed = "closed"
+)
+
+const (
+	DispatchConventional = "conventional"
+	DispatchDestination  = "destination"
 )
 
 func ValidateLiftRequestStatus(status string) error {
 	status = strings.ToLower(status)
 	switch status {
-	case StatusQueued, StatusCompleted:
+	case StatusQueued, StatusPending, StatusCompleted, StatusCancelled, StatusRecalled:
 		return nil // Status is valid.
 	default:
-		return errors.New("invalid status, valid status are queued, completed")
+		return errors.New("invalid status, valid status are queued, pending, completed, cancelled, recalled")
+	}
+}
+
+// HasFloor tells whether the floor is in the building of the session.
+func (session *Session) HasFloor(floor int) bool {
+	return floor >= session.MinFloor && floor <= session.MaxFloor
+}
+
+// ValidateCallDirection checks the direction of a hall call on the floor, there
+// is no going up from the top floor or down from the lowest floor.
+func ValidateCallDirection(direction string, floor int, minFloor int, maxFloor int) error {
+	switch strings.ToLower(direction) {
+	case DirectionUp:
+		if floor >= maxFloor {
+			return errors.New("can't go up from the top floor")
+		}
+	case DirectionDown:
+		if floor <= minFloor {
+			return errors.New("can't go down from the lowest floor")
+		}
+	default:
+		return errors.New("invalid direction, valid directions are up, down")
+	}
+	return nil
+}
+
+// DefaultCallDirection is the direction of a hall call that didn't say where
+// it is going, up unless it is on the top floor.
+func DefaultCallDirection(floor int, maxFloor int) string {
+	if floor >= maxFloor {
+		return DirectionDown
+	}
+	return DirectionUp
+}
+
+func ValidateDispatchMode(mode string) error {
+	switch strings.ToLower(mode) {
+	case DispatchConventional, DispatchDestination:
+		return nil
+	default:
+		return errors.New("invalid dispatch mode, valid modes are conventional, destination")
 	}
 }
+
 func ValidateLiftStatus(status string) error {
 	status = strings.ToLower(status)
 	switch status {
-	case StatusIdle, StatusBusy:
+	case StatusIdle, StatusMovingUp, StatusMovingDown, StatusDoorsOpen, StatusOutOfService:
 		return nil // Status is valid.
 	default:
-		return errors.New("invalid status, valid status are idle, busy")
+		return errors.New("invalid status, valid status are idle, moving_up, moving_down, doors_open, out_of_service")
 	}
 }
 
-var liftCollection *mongo.Collection
-var liftRequestCollection *mongo.Collection
-var sessionCollection *mongo.Collection
-
-func CreateDBInstance() {
-	connectionString := os.Getenv("DB_URI")
-	dbName := os.Getenv("DB_NAME")
-	liftCollName := os.Getenv("DB_LIFT_COLLECTION_NAME")
-	liftRequestCollName := os.Getenv("DB_LIFT_REQUEST_COLLECTION_NAME")
-	sessionCollName := os.Getenv("DB_SESSION_COLLECTION_NAME")
-
-	clientOptions := options.Client().ApplyURI(connectionString)
-
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-
+// ParseID reads an object id from a url or body, what names the id in the error.
+func ParseID(id string, what string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		log.Fatal(err)
+		return primitive.NilObjectID, utils.InvalidArgument("invalid %v id %q", what, id)
 	}
+	return objectID, nil
+}
 
-	err = client.Ping(context.TODO(), nil)
+func GetSession(sessionID string) (*Session, error) {
+	sessionObjectID, err := ParseID(sessionID, "session")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	fmt.Println("Connected to mongodb")
+	session, err := db.GetSession(sessionObjectID)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Found document: %+v\n", session.ID)
 
-	liftCollection = client.Database(dbName).Collection(liftCollName)
-	liftRequestCollection = client.Database(dbName).Collection(liftRequestCollName)
-	sessionCollection = client.Database(dbName).Collection(sessionCollName)
+	return session, nil
 }
 
-func CreateSession(floors int, lifts int) (*Session, error) {
-	var interfacesObjs []interface{}
-	for i := 0; i < lifts; i++ {
-		lift := Lift{CurrentFloor: 0, Status: "idle"}
-		interfacesObjs = append(interfacesObjs, lift)
+// CreateLiftRequest makes a hall call on the floor. In destination dispatch
+// sessions the passenger keys in the destination as well, the direction then
+// follows from it, and passengers going the same way share a request.
+func CreateLiftRequest(floor int, direction string, destination *int, sessionID string) (*LiftRequest, *LiftRequestResponse, error) {
+	sessionObjectID, err := ParseID(sessionID, "session")
+	if err != nil {
+		return nil, nil, err
 	}
 
-	liftResults, err := liftCollection.InsertMany(context.Background(), interfacesObjs)
+	session, err := db.GetSession(sessionObjectID)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return nil, nil, err
 	}
+	fmt.Printf("Found document Session: %+v\n", session.ID)
 
-	// Create a slice to store the inserted lift IDs.
-	var insertedLiftIDs []primitive.ObjectID
-	for _, result := range liftResults.InsertedIDs {
-		insertedLiftIDs = append(insertedLiftIDs, result.(primitive.ObjectID))
-	}
+	TouchSession(session.ID)
 
-	var insertedLifts []Lift
-	for _, id := range insertedLiftIDs {
-		insertedLifts = append(insertedLifts, Lift{ID: id, CurrentFloor: 0, Status: "idle"})
+	if err := session.checkNoEmergency(); err != nil {
+		return nil, nil, err
+	}
+	if err := session.checkFloorServed(floor); err != nil {
+		return nil, nil, err
+	}
+	// A trip no lift makes in one go takes the passenger to a sky lobby first.
+	transfer := false
+	if destination != nil {
+		lobby, err := session.planTransfer(floor, *destination)
+		if err != nil {
+			return nil, nil, err
+		}
+		if lobby != nil {
+			destination, transfer = lobby, true
+		}
+		direction = headingTowards(floor, *destination)
+	}
+	if direction == "" {
+		direction = DefaultCallDirection(floor, session.MaxFloor)
+	}
+	direction = strings.ToLower(direction)
+
+	// The call is stored as pending first so a second call for the same floor
+	// and direction is turned down before any lift is touched.
+	liftRequest := LiftRequest{RequestedFloor: floor, Direction: direction, Destination: destination, Type: RequestHall, Status: StatusPending, Session: sessionObjectID, CreatedAt: time.Now()}
+	if err := db.CreateLiftRequest(&liftRequest); err != nil {
+		if err == ErrDuplicateLiftRequest && destination != nil {
+			return joinLiftRequest(session, &liftRequest)
+		}
+		return nil, nil, err
 	}
 
-	// Create the Session object with the inserted lift IDs.
-	sessionDoc := SessionDocument{Floors: floors, Lifts: insertedLiftIDs}
-	result, err := sessionCollection.InsertOne(context.Background(), sessionDoc)
-
+	// With no lift able to take it the call waits as a pending request, it is
+	// assigned by AssignPendingLiftRequests once a lift frees up.
+	assignment, err := assignLiftRequest(session, &liftRequest)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return nil, nil, err
+	}
+	response := &LiftRequestResponse{ID: liftRequest.ID, RequestedFloor: floor, Direction: direction, Destination: destination, Transfer: transfer, Type: RequestHall, Status: liftRequest.Status, Session: sessionObjectID}
+	if assignment != nil {
+		response.Lift = *findLift(session, assignment.Car)
+		response.ETA = assignment.ETA.Seconds()
+		if liftRequest.Claimed {
+			// The session was read before the lift was claimed, the lift is
+			// shown setting off for the call like the trip it is sent on.
+			response.Lift.Status = statusTowards(response.Lift.CurrentFloor, floor)
+			response.Lift.Direction = direction
+			if response.Lift.CurrentFloor != floor {
+				response.Lift.Direction = headingTowards(response.Lift.CurrentFloor, floor)
+			}
+		}
 	}
+	return &liftRequest, response, nil
+}
 
-	session := Session{Floors: floors, Lifts: insertedLifts, ID: result.InsertedID.(primitive.ObjectID)}
-	return &session, nil
+// joinLiftRequest answers a passenger keying in a trip someone on the floor is
+// already waiting for with that request, they board the same lift.
+func joinLiftRequest(session *Session, liftRequest *LiftRequest) (*LiftRequest, *LiftRequestResponse, error) {
+	for _, status := range []string{StatusQueued, StatusPending} {
+		activeRequests, err := db.GetLiftRequests(session.ID, status)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, active := range activeRequests {
+			if active.Type != RequestHall || active.RequestedFloor != liftRequest.RequestedFloor || active.Direction != liftRequest.Direction || !sameDestination(active.Destination, liftRequest.Destination) {
+				continue
+			}
+			response := &LiftRequestResponse{ID: active.ID, RequestedFloor: active.RequestedFloor, Direction: active.Direction, Destination: active.Destination, Type: RequestHall, Status: active.Status, Session: session.ID}
+			if lift := findLift(session, active.Lift); lift != nil {
+				response.Lift = *lift
+				// The stops the lift makes on the way aren't known here, the
+				// ETA only counts the travel.
+				response.ETA = session.Kinematics.forLift(lift).TravelDuration(active.RequestedFloor - lift.CurrentFloor).Seconds()
+			}
+			return active, response, nil
+		}
+	}
+	// The request went inactive in between, the passenger has to call again.
+	return nil, nil, ErrDuplicateLiftRequest
 }
 
-func GetSession(sessionID string) (*Session, error) {
-	sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+// assignLiftRequest dispatches a pending request. An idle lift is claimed for
+// it before anything else, so concurrent calls don't pile onto the same one,
+// while a lift already heading past the floor just gets another stop. It
+// returns nil when no lift can take the request now.
+func assignLiftRequest(session *Session, liftRequest *LiftRequest) (*dispatcher.Assignment, error) {
+	call := dispatcher.Call{Floor: liftRequest.RequestedFloor, Direction: liftRequest.Direction, Destination: liftRequest.Destination}
+	destinations, err := waitingDestinations(liftRequest)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	for attempt := 0; attempt <= len(session.Lifts); attempt++ {
+		activeRequests, err := db.GetLiftRequests(session.ID, StatusQueued)
+		if err != nil {
+			return nil, err
+		}
+		assignment, ok := liftDispatcher.Assign(call, dispatchCars(session, activeRequests, call, destinations), session.Kinematics)
+		if !ok {
+			return nil, nil
+		}
 
-	sessionFilter := bson.M{"_id": sessionObjectID}
-	var sessionDoc SessionDocument
+		lift := findLift(session, assignment.Car)
+		status := statusTowards(lift.CurrentFloor, liftRequest.RequestedFloor)
+		if lift.Status == StatusIdle {
+			err := db.ClaimLift(lift.ID, status)
+			if err == ErrLiftTaken {
+				// Another request got to it first, dispatch again on fresh state.
+				if session, err = db.GetSession(session.ID); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			liftRequest.Claimed = true
+		}
 
-	err = sessionCollection.FindOne(context.TODO(), sessionFilter).Decode(&sessionDoc)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Session Document not found")
-		} else {
-			log.Fatal(err)
+		liftRequest.Lift = lift.ID
+		liftRequest.Status = StatusQueued
+		if err := db.AssignLiftRequest(liftRequest); err != nil {
+			if err == ErrLiftRequestNotActive && liftRequest.Claimed {
+				// Cancelled while it was dispatched, the claimed lift finds no
+				// stop once it gets going and frees itself.
+				liftRequest.Status = StatusCancelled
+				return nil, nil
+			}
+			return nil, err
 		}
-	} else {
-		fmt.Printf("Found document: %+v\n", sessionDoc.ID)
+		if !liftRequest.Claimed && db.ClaimLift(lift.ID, status) == nil {
+			// The lift ran out of stops since the session was read.
+			liftRequest.Claimed = true
+		}
+		return assignment, nil
 	}
+	return nil, nil
+}
 
-	var liftIds = []primitive.ObjectID{}
-	liftIds = append(liftIds, sessionDoc.Lifts...)
-
-	liftFilter := bson.M{"_id": bson.M{"$in": liftIds}}
-	var lifts []Lift
-
-	liftCursor, err := liftCollection.Find(context.TODO(), liftFilter)
-	if err != nil {
-		log.Fatal(err)
+func sameDestination(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-	defer liftCursor.Close(context.TODO())
+	return *a == *b
+}
 
-	for liftCursor.Next(context.TODO()) {
-		var doc Lift
-		err := liftCursor.Decode(&doc)
-		if err != nil {
-			log.Fatal(err)
+func findLift(session *Session, liftID primitive.ObjectID) *Lift {
+	for i := range session.Lifts {
+		if session.Lifts[i].ID == liftID {
+			return &session.Lifts[i]
 		}
-		lifts = append(lifts, doc)
 	}
-
-	session := Session{ID: sessionDoc.ID, Floors: sessionDoc.Floors, Lifts: lifts}
-
-	return &session, nil
+	return nil
 }
 
-func CreateLiftRequest(floor int, sessionID string) (*LiftRequest, *LiftRequestResponse, error) {
-	sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+// AddDestination adds the floor to the stops of the lift, as a passenger inside
+// it would. The request is Claimed when the lift was idle, the caller has to
+// get it moving then, a moving lift reaches the stop on its way.
+func AddDestination(sessionID primitive.ObjectID, liftID primitive.ObjectID, floor int) (*LiftRequest, error) {
+	session, err := db.GetSession(sessionID)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	lift := findLift(session, liftID)
+	if lift == nil {
+		return nil, ErrLiftNotFound
+	}
+	if !session.HasFloor(floor) {
+		return nil, utils.InvalidArgument("floor must be between %d and %d", session.MinFloor, session.MaxFloor)
+	}
+	if !lift.servesFloor(floor) {
+		return nil, utils.InvalidArgument("Lift doesn't serve floor %v", session.FloorLabel(floor))
+	}
+	if lift.Maintenance {
+		return nil, ErrLiftOutOfService
+	}
+	if err := session.checkNoEmergency(); err != nil {
+		return nil, err
 	}
 
-	sessionFilter := bson.M{"_id": sessionObjectID}
-	var sessionDoc SessionDocument
+	TouchSession(session.ID)
 
-	err = sessionCollection.FindOne(context.TODO(), sessionFilter).Decode(&sessionDoc)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Session Document not found")
-		} else {
-			log.Fatal(err)
-		}
-	} else {
-		fmt.Printf("Found document Session: %+v\n", sessionDoc.ID)
+	liftRequest := LiftRequest{RequestedFloor: floor, Type: RequestCar, Status: StatusQueued, Lift: liftID, Session: sessionID, CreatedAt: time.Now()}
+	if err := db.CreateLiftRequest(&liftRequest); err != nil {
+		return nil, err
 	}
 
-	liftRequestFilter := bson.M{"session": sessionObjectID, "requestedfloor": floor, "status": StatusQueued}
-	var liftRequestPresent LiftRequest
-	err = liftRequestCollection.FindOne(context.TODO(), liftRequestFilter).Decode(&liftRequestPresent)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Lift Request Document not found")
-		} else {
-			log.Fatal(err)
-		}
-	} else {
-		fmt.Printf("Found document Lift Request: %+v\n", liftRequestPresent.ID)
+	err = db.ClaimLift(liftID, statusTowards(lift.CurrentFloor, floor))
+	if err != nil && err != ErrLiftTaken {
+		return nil, err
 	}
+	liftRequest.Claimed = err == nil
+	return &liftRequest, nil
+}
 
-	if liftRequestPresent.ID != primitive.NilObjectID {
-		return nil, nil, &utils.CustomError{Message: "Already a lift is called for the floor"}
-	}
+// GetLiftStops lists the requests the lift still has to serve, in the order it
+// serves them.
+func GetLiftStops(liftID primitive.ObjectID) ([]*LiftRequest, error) {
+	return db.GetLiftStops(liftID)
+}
 
-	var liftIds = []primitive.ObjectID{}
-	liftIds = append(liftIds, sessionDoc.Lifts...)
+// ClaimLift moves an idle lift to the given status, it fails with ErrLiftTaken
+// when the lift is not idle.
+func ClaimLift(liftID primitive.ObjectID, status string) error {
+	return db.ClaimLift(liftID, status)
+}
 
-	liftFilter := bson.M{"_id": bson.M{"$in": liftIds}, "status": StatusIdle}
-	var lift Lift
+// FreeLift parks the lift once it has no stops left, it returns the status the
+// lift parked in, out_of_service for a lift under maintenance.
+func FreeLift(liftID primitive.ObjectID) (*Lift, error) {
+	return db.FreeLift(liftID)
+}
 
-	err = liftCollection.FindOne(context.TODO(), liftFilter).Decode(&lift)
+// AssignPendingLiftRequests hands the pending requests of the session, oldest
+// first, to the lifts that can take them now. It returns the requests it
+// assigned, the Claimed ones need their lift to be set moving.
+func AssignPendingLiftRequests(sessionID primitive.ObjectID) ([]*LiftRequest, error) {
+	session, err := db.GetSession(sessionID)
 	if err != nil {
-		return nil, nil, &utils.CustomError{Message: "No lift available right now"}
+		return nil, err
 	}
-
-	liftRequest := LiftRequest{RequestedFloor: floor, Status: StatusQueued, Lift: lift.ID, Session: sessionObjectID}
-
-	result, err := liftRequestCollection.InsertOne(context.TODO(), liftRequest)
+	pendingRequests, err := db.GetLiftRequests(sessionID, StatusPending)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	liftRequest.ID = result.InsertedID.(primitive.ObjectID)
 
-	_, err = liftCollection.UpdateOne(context.TODO(), bson.M{"_id": lift.ID}, bson.M{"$set": bson.M{
-		"status": "busy",
-	}})
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Lift Document not found")
-		} else {
-			log.Fatal(err)
+	var assigned []*LiftRequest
+	for _, liftRequest := range pendingRequests {
+		assignment, err := assignLiftRequest(session, liftRequest)
+		if err == ErrLiftRequestNotActive {
+			// Cancelled while it waited.
+			continue
+		}
+		if err != nil {
+			return assigned, err
+		}
+		if assignment != nil || liftRequest.Claimed {
+			assigned = append(assigned, liftRequest)
+			if session, err = db.GetSession(sessionID); err != nil {
+				return assigned, err
+			}
 		}
-	} else {
-		fmt.Printf("Update document successfully: %+v\n", lift.ID.Hex())
 	}
 
-	return &liftRequest, &LiftRequestResponse{ID: result.InsertedID.(primitive.ObjectID), RequestedFloor: floor, Status: StatusQueued, Lift: lift, Session: sessionObjectID}, nil
+	return assigned, nil
 }
 
 func GetLiftRequests(sessionID string, requestStatus string) ([]*LiftRequest, error) {
@@ -273,81 +548,121 @@ func GetLiftRequests(sessionID string, requestStatus string) ([]*LiftRequest, er
 		requestStatus = StatusQueued
 	}
 	if err := ValidateLiftRequestStatus(requestStatus); err != nil {
-		return nil, &utils.CustomError{Message: requestStatus + " ,is not a valid status"}
+		return nil, utils.InvalidArgument("%v ,is not a valid status", requestStatus)
 	}
+	requestStatus = strings.ToLower(requestStatus)
 
-	liftRequestsFilters := bson.M{}
-	liftRequestsFilters["status"] = requestStatus
-
+	sessionObjectID := primitive.NilObjectID
 	if sessionID != "" {
-		var sessionDoc SessionDocument
-		sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+		var err error
+		sessionObjectID, err = ParseID(sessionID, "session")
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 
-		sessionFilters := bson.M{"_id": sessionObjectID}
-		err = sessionCollection.FindOne(context.TODO(), sessionFilters).Decode(&sessionDoc)
-		if err != nil {
-			fmt.Print(err, sessionID)
-			return nil, &utils.CustomError{Message: "Session Not Found"}
+		if _, err := db.GetSession(sessionObjectID); err != nil {
+			return nil, err
 		}
-
-		liftRequestsFilters["session"] = sessionObjectID
 	}
 
-	curr, err := liftRequestCollection.Find(context.TODO(), liftRequestsFilters)
+	return db.GetLiftRequests(sessionObjectID, requestStatus)
+}
+
+// Backlog is the number of active requests of the session, the hall calls
+// waiting for a lift and the stops queued on one.
+func Backlog(sessionID primitive.ObjectID) (int, error) {
+	return db.CountActiveLiftRequests(sessionID)
+}
+
+// UpdateLiftState saves where a lift in transit is, its direction and doors as
+// of the virtual time at.
+func UpdateLiftState(lift *Lift, at time.Duration) error {
+	lift.SavedAt = at
+	return db.UpdateLiftState(lift)
+}
+
+// GetLift returns the lift if it belongs to the session.
+func GetLift(sessionID primitive.ObjectID, liftID primitive.ObjectID) (*Lift, error) {
+	session, err := db.GetSession(sessionID)
 	if err != nil {
 		return nil, err
 	}
-	defer curr.Close(context.TODO())
-
-	var results []*LiftRequest
-	for curr.Next(context.TODO()) {
-		var result LiftRequest
-		e := curr.Decode(&result)
-		if e != nil {
-			log.Fatal(e)
-		}
-		results = append(results, &result)
+	lift := findLift(session, liftID)
+	if lift == nil {
+		return nil, ErrLiftNotFound
 	}
+	return lift, nil
+}
+
+func CompleteLiftRequest(liftRequest *LiftRequest) error {
+	return db.CompleteLiftRequest(liftRequest)
+}
 
-	if err := curr.Err(); err != nil {
+// GetLiftRequest returns the request if it belongs to the session.
+func GetLiftRequest(sessionID primitive.ObjectID, requestID primitive.ObjectID) (*LiftRequest, error) {
+	liftRequest, err := db.GetLiftRequest(requestID)
+	if err != nil {
 		return nil, err
 	}
+	if liftRequest.Session != sessionID {
+		return nil, ErrLiftRequestNotFound
+	}
+	return liftRequest, nil
+}
 
-	return results, nil
+// CancelLiftRequest withdraws a queued or pending request, the lift it was
+// assigned to is left to the caller.
+func CancelLiftRequest(liftRequest *LiftRequest) error {
+	if liftRequest.Status != StatusQueued && liftRequest.Status != StatusPending {
+		return utils.Conflict("Lift request is already %v", liftRequest.Status)
+	}
+	TouchSession(liftRequest.Session)
+	if err := db.CancelLiftRequest(liftRequest); err != nil {
+		return err
+	}
+	return cancelWaitingPassengers(liftRequest)
 }
 
-func CompleteLiftRequest(liftRequest *LiftRequest) error {
-	liftRequestFilter := bson.M{"_id": liftRequest.ID}
-	updatedLiftRequest := bson.M{"$set": bson.M{
-		"status": "completed",
-	}}
+const (
+	DefaultSessionsLimit = 20
+	MaxSessionsLimit     = 100
+)
 
-	_, err := liftRequestCollection.UpdateOne(context.TODO(), liftRequestFilter, updatedLiftRequest)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Lift Request Document not found")
-		} else {
-			log.Fatal(err)
-		}
-	} else {
-		fmt.Printf("Update document successfully LiftRequest: %+v\n", liftRequest.ID.Hex())
+// ListSessions returns a page of sessions, newest first. Pages start at 1.
+func ListSessions(page int, limit int) (*SessionList, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = DefaultSessionsLimit
+	}
+	if limit > MaxSessionsLimit {
+		limit = MaxSessionsLimit
 	}
 
-	_, err = liftCollection.UpdateOne(context.TODO(), bson.M{"_id": liftRequest.Lift}, bson.M{"$set": bson.M{
-		"status": "idle", "currentfloor": liftRequest.RequestedFloor,
-	}})
+	sessions, total, err := db.ListSessions((page-1)*limit, limit)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("Lift Document not found")
-		} else {
-			log.Fatal(err)
-		}
-	} else {
-		fmt.Printf("Update document successfully Lift: %+v\n", liftRequest.Lift.Hex())
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []*Session{}
 	}
+	return &SessionList{Sessions: sessions, Page: page, Limit: limit, Total: total}, nil
+}
 
-	return nil
+// DeleteSession removes the session along with its lifts and requests.
+func DeleteSession(sessionID primitive.ObjectID) error {
+	return db.DeleteSession(sessionID)
+}
+
+// TouchSession records activity on the session, idle sessions get reaped.
+func TouchSession(sessionID primitive.ObjectID) {
+	if err := db.TouchSession(sessionID, time.Now()); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetIdleSessions lists the sessions without any activity since the given time.
+func GetIdleSessions(since time.Time) ([]primitive.ObjectID, error) {
+	return db.GetIdleSessions(since)
 }
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestConcurrentLiftRequests fires hundreds of hall calls and claims at one
+// session at once, no lift may be claimed twice and no hall call stored twice.
+func TestConcurrentLiftRequests(t *testing.T) {
+	UseStore(NewMemoryStore())
+	session, err := CreateSession(SessionConfig{Floors: 20, Kinematics: DefaultKinematics(), Lifts: make([]LiftConfig, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	claims := make(map[primitive.ObjectID]int)
+	created := 0
+	var failures []error
+
+	var wg sync.WaitGroup
+	for i := 0; i < 400; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%5 == 0 {
+				// Someone else, like a car call, takes an idle lift directly.
+				liftID := session.Lifts[i%len(session.Lifts)].ID
+				err := ClaimLift(liftID, StatusMovingUp)
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					claims[liftID]++
+				} else if err != ErrLiftTaken {
+					failures = append(failures, err)
+				}
+				return
+			}
+
+			floor := 1 + i%18
+			direction := DirectionUp
+			if (i/18)%2 == 1 {
+				direction = DirectionDown
+			}
+			liftRequest, _, err := CreateLiftRequest(floor, direction, nil, session.ID.Hex())
+			mu.Lock()
+			defer mu.Unlock()
+			if err == ErrDuplicateLiftRequest {
+				return
+			}
+			if err != nil {
+				failures = append(failures, err)
+				return
+			}
+			created++
+			if liftRequest.Claimed {
+				claims[liftRequest.Lift]++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range failures {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Nothing frees the lifts, so every lift can be claimed once at most.
+	for liftID, count := range claims {
+		if count > 1 {
+			t.Errorf("lift %v was claimed %d times", liftID.Hex(), count)
+		}
+	}
+
+	reloaded, err := GetSession(session.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimedLifts := 0
+	for _, lift := range reloaded.Lifts {
+		if lift.Status != StatusIdle {
+			claimedLifts++
+		}
+	}
+	if claimedLifts != len(claims) {
+		t.Errorf("%d lifts are claimed but %d claims succeeded", claimedLifts, len(claims))
+	}
+
+	seen := make(map[string]bool)
+	active := 0
+	for _, status := range []string{StatusQueued, StatusPending} {
+		liftRequests, err := GetLiftRequests(session.ID.Hex(), status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, liftRequest := range liftRequests {
+			key := fmt.Sprintf("%d %s", liftRequest.RequestedFloor, liftRequest.Direction)
+			if seen[key] {
+				t.Errorf("hall call %v is active twice", key)
+			}
+			seen[key] = true
+			active++
+			if status == StatusQueued && findLift(reloaded, liftRequest.Lift) == nil {
+				t.Errorf("queued hall call %v has no lift of the session", key)
+			}
+		}
+	}
+	if active != created {
+		t.Errorf("%d hall calls are active but %d were created", active, created)
+	}
+}
+
+func TestCreateLiftRequestShowsClaimedLift(t *testing.T) {
+	UseStore(NewMemoryStore())
+	session, err := CreateSession(SessionConfig{Floors: 10, Kinematics: DefaultKinematics(), Lifts: make([]LiftConfig, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	liftRequest, response, err := CreateLiftRequest(5, DirectionDown, nil, session.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !liftRequest.Claimed {
+		t.Fatal("the idle lift wasn't claimed")
+	}
+	if response.Lift.Status != StatusMovingUp || response.Lift.Direction != DirectionUp {
+		t.Fatalf("response shows the lift %v heading %v, want %v heading %v", response.Lift.Status, response.Lift.Direction, StatusMovingUp, DirectionUp)
+	}
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultSecondsPerFloor = 2
+	DefaultDoorDwell       = 5
+)
+
+// Kinematics describes how the lifts of a session move. SecondsPerFloor is the
+// cruising pace, DoorDwell the seconds the doors need to open, stay open and
+// close again at a stop, and Acceleration, in floors/s², ramps the lift up to
+// the cruising pace and back down. An Acceleration of 0 starts and stops the
+// lift instantly.
+type Kinematics struct {
+	SecondsPerFloor float64 `json:"secondsPerFloor"`
+	DoorDwell       float64 `json:"doorDwell"`
+	Acceleration    float64 `json:"acceleration"`
+}
+
+// Trip is the timing of a lift going to its next stop. Heading is the way the
+// lift goes, it stays set for a trip to the floor the lift is on.
+type Trip struct {
+	Lift      primitive.ObjectID
+	FromFloor int
+	ToFloor   int
+	Heading   string
+	Travel    time.Duration
+	Door      time.Duration
+	// FloorOffsets holds, for every floor on the way, the time after departure
+	// at which the lift reaches it. The last one is the arrival.
+	FloorOffsets []time.Duration
+	// Departure is how long the lift waits before it sets off, Faults what held
+	// it up and DoorJam the extra time its doors stay open at the stop.
+	Departure time.Duration
+	Faults    []Fault
+	DoorJam   time.Duration
+}
+
+func (trip *Trip) Direction() string {
+	if trip.ToFloor > trip.FromFloor {
+		return DirectionUp
+	} else if trip.ToFloor < trip.FromFloor {
+		return DirectionDown
+	}
+	return DirectionNone
+}
+
+// Status is the status of the lift while it makes the trip.
+func (trip *Trip) Status() string {
+	return statusTowards(trip.FromFloor, trip.ToFloor)
+}
+
+func DefaultKinematics() Kinematics {
+	return Kinematics{SecondsPerFloor: DefaultSecondsPerFloor, DoorDwell: DefaultDoorDwell}
+}
+
+// withDefaults fills the parameters the caller left out, sessions created
+// before kinematics existed load with all of them zero.
+func (k Kinematics) withDefaults() Kinematics {
+	if k.SecondsPerFloor == 0 {
+		k.SecondsPerFloor = DefaultSecondsPerFloor
+	}
+	if k.DoorDwell == 0 {
+		k.DoorDwell = DefaultDoorDwell
+	}
+	return k
+}
+
+func (k Kinematics) Validate() error {
+	if k.SecondsPerFloor < 0 {
+		return utils.InvalidArgument("secondsPerFloor can't be negative")
+	}
+	if k.DoorDwell < 0 {
+		return utils.InvalidArgument("doorDwell can't be negative")
+	}
+	if k.Acceleration < 0 {
+		return utils.InvalidArgument("acceleration can't be negative")
+	}
+	return nil
+}
+
+// TravelDuration is the time needed to move the given number of floors without
+// stopping in between.
+func (k Kinematics) TravelDuration(floors int) time.Duration {
+	k = k.withDefaults()
+	distance := math.Abs(float64(floors))
+	if distance == 0 {
+		return 0
+	}
+
+	seconds := distance * k.SecondsPerFloor
+	if k.Acceleration > 0 {
+		speed := 1 / k.SecondsPerFloor
+		// Floors spent speeding up and slowing down to and from the cruising pace.
+		rampDistance := speed * speed / k.Acceleration
+		if distance >= rampDistance {
+			seconds = distance/speed + speed/k.Acceleration
+		} else {
+			seconds = 2 * math.Sqrt(distance/k.Acceleration)
+		}
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// FloorOffsets returns the time after departure at which a lift traveling the
+// given number of floors reaches each floor on its way.
+func (k Kinematics) FloorOffsets(floors int) []time.Duration {
+	k = k.withDefaults()
+	distance := int(math.Abs(float64(floors)))
+	total := k.TravelDuration(distance).Seconds()
+
+	offsets := make([]time.Duration, 0, distance)
+	for x := 1; x <= distance; x++ {
+		seconds := float64(x) * k.SecondsPerFloor
+		if k.Acceleration > 0 {
+			seconds = k.passTime(float64(x), float64(distance), total)
+		}
+		offsets = append(offsets, time.Duration(seconds*float64(time.Second)))
+	}
+	return offsets
+}
+
+// passTime is the time at which an accelerating lift covers x of its distance
+// floors, it mirrors the speed profile used by TravelDuration.
+func (k Kinematics) passTime(x float64, distance float64, total float64) float64 {
+	speed := 1 / k.SecondsPerFloor
+	rampDistance := speed * speed / (2 * k.Acceleration)
+	if distance < 2*rampDistance {
+		// The lift never reaches the cruising pace, it brakes from halfway.
+		rampDistance = distance / 2
+	}
+
+	switch {
+	case x <= rampDistance:
+		return math.Sqrt(2 * x / k.Acceleration)
+	case x >= distance-rampDistance:
+		return total - math.Sqrt(2*(distance-x)/k.Acceleration)
+	default:
+		return speed/k.Acceleration + (x-rampDistance)/speed
+	}
+}
+
+func (k Kinematics) DoorDuration() time.Duration {
+	k = k.withDefaults()
+	return time.Duration(k.DoorDwell * float64(time.Second))
+}
+
+// PlanNextStop computes the trip of the lift to its next stop, picked with the
+// LOOK algorithm, and how long it then stays there with its doors open. It
+// returns nil when the lift has no stops left.
+func PlanNextStop(sessionID primitive.ObjectID, liftID primitive.ObjectID) (*Trip, error) {
+	session, err := db.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	lift := findLift(session, liftID)
+	if lift == nil {
+		return nil, ErrLiftNotFound
+	}
+	if session.Emergency.Active {
+		return session.recallTrip(lift), nil
+	}
+	stops, err := db.GetLiftStops(liftID)
+	if err != nil {
+		return nil, err
+	}
+	if !lift.takesHallCalls() {
+		stops = carStops(stops)
+	}
+
+	toFloor, heading, ok := lookTarget(lift.CurrentFloor, lift.Direction, stops)
+	if !ok {
+		return nil, nil
+	}
+	kinematics := session.Kinematics.forLift(lift)
+	trip := &Trip{Lift: liftID, FromFloor: lift.CurrentFloor, ToFloor: toFloor, Heading: heading, Door: kinematics.DoorDuration()}
+	trip.Travel = kinematics.TravelDuration(trip.ToFloor - trip.FromFloor)
+	trip.FloorOffsets = kinematics.FloorOffsets(trip.ToFloor - trip.FromFloor)
+	return trip, nil
+}
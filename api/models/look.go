@@ -0,0 +1,177 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Lifts serve their stops with the LOOK algorithm: a lift keeps heading the same
+// way while there are stops ahead of it that way and turns around once there
+// are none. Hall calls going the other way are picked up on the way back.
+
+func opposite(heading string) string {
+	switch heading {
+	case DirectionUp:
+		return DirectionDown
+	case DirectionDown:
+		return DirectionUp
+	}
+	return DirectionNone
+}
+
+func isAhead(floor int, from int, heading string) bool {
+	switch heading {
+	case DirectionUp:
+		return floor > from
+	case DirectionDown:
+		return floor < from
+	}
+	return false
+}
+
+func distance(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// headingTowards is the way to go from one floor to another.
+func headingTowards(from int, to int) string {
+	if to > from {
+		return DirectionUp
+	} else if to < from {
+		return DirectionDown
+	}
+	return DirectionNone
+}
+
+// statusTowards is the status of a lift setting off from one floor to another.
+func statusTowards(from int, to int) string {
+	if to > from {
+		return StatusMovingUp
+	} else if to < from {
+		return StatusMovingDown
+	}
+	return StatusDoorsOpen
+}
+
+// serves tells whether a lift heading the given way picks the request up when
+// it stops on its floor, car calls are served whichever way the lift goes.
+func serves(liftRequest *LiftRequest, heading string) bool {
+	return liftRequest.Type == RequestCar || liftRequest.Direction == "" || heading == DirectionNone || liftRequest.Direction == heading
+}
+
+// lookTarget picks the floor the lift goes to next and the way it heads from
+// there. An idle lift goes for the nearest stop.
+func lookTarget(floor int, heading string, stops []*LiftRequest) (int, string, bool) {
+	if len(stops) == 0 {
+		return floor, DirectionNone, false
+	}
+
+	if heading == DirectionNone || heading == "" {
+		nearest := stops[0]
+		for _, stop := range stops[1:] {
+			if distance(stop.RequestedFloor, floor) < distance(nearest.RequestedFloor, floor) {
+				nearest = stop
+			}
+		}
+		heading = nearest.Direction
+		if nearest.RequestedFloor != floor || heading == "" {
+			heading = headingTowards(floor, nearest.RequestedFloor)
+		}
+		return nearest.RequestedFloor, heading, true
+	}
+
+	for turn := 0; turn < 2; turn++ {
+		next, farthest := -1, -1
+		for _, stop := range stops {
+			stopFloor := stop.RequestedFloor
+			if stopFloor == floor && serves(stop, heading) {
+				return floor, heading, true
+			}
+			if !isAhead(stopFloor, floor, heading) {
+				continue
+			}
+			if serves(stop, heading) {
+				if next == -1 || distance(stopFloor, floor) < distance(next, floor) {
+					next = stopFloor
+				}
+			} else if farthest == -1 || distance(stopFloor, floor) > distance(farthest, floor) {
+				// A call going the other way is reached last, from there the
+				// lift turns around for it.
+				farthest = stopFloor
+			}
+		}
+		if next != -1 {
+			return next, heading, true
+		}
+		if farthest != -1 {
+			return farthest, heading, true
+		}
+		heading = opposite(heading)
+	}
+	return floor, heading, true
+}
+
+// serveAt returns the stops a lift arriving on the floor serves and the way it
+// heads from there. It keeps its heading while it has a reason to, a hall call
+// that way on this floor or stops further ahead, and turns around otherwise.
+func serveAt(floor int, heading string, stops []*LiftRequest) ([]*LiftRequest, string) {
+	hallCall := func(direction string) bool {
+		for _, stop := range stops {
+			if stop.RequestedFloor == floor && stop.Type != RequestCar && stop.Direction == direction {
+				return true
+			}
+		}
+		return false
+	}
+	stopsAhead := func(direction string) bool {
+		for _, stop := range stops {
+			if isAhead(stop.RequestedFloor, floor, direction) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if heading == DirectionNone {
+		for _, stop := range stops {
+			if stop.RequestedFloor == floor && stop.Type != RequestCar && stop.Direction != "" {
+				heading = stop.Direction
+				break
+			}
+		}
+	}
+	if heading != DirectionNone && !hallCall(heading) && !stopsAhead(heading) && (hallCall(opposite(heading)) || stopsAhead(opposite(heading))) {
+		heading = opposite(heading)
+	}
+
+	var served []*LiftRequest
+	for _, stop := range stops {
+		if stop.RequestedFloor == floor && serves(stop, heading) {
+			served = append(served, stop)
+		}
+	}
+	return served, heading
+}
+
+// ShouldStopAt tells whether a lift passing the floor on its way has a stop
+// there, one added after the lift set off. A full lift, or one under
+// maintenance, passes hall calls by.
+func ShouldStopAt(sessionID primitive.ObjectID, liftID primitive.ObjectID, floor int, heading string) (bool, error) {
+	lift, err := GetLift(sessionID, liftID)
+	if err != nil {
+		return false, err
+	}
+	stops, err := db.GetLiftStops(liftID)
+	if err != nil {
+		return false, err
+	}
+	if !lift.takesHallCalls() {
+		stops = carStops(stops)
+	}
+	for _, stop := range stops {
+		if stop.RequestedFloor == floor && serves(stop, heading) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// SetLiftMaintenance takes the lift out of service or puts it back. The hall
+// calls of a lift taken out go back to pending for the other lifts, they are
+// returned so the caller can turn the lift away from them. Its riders are still
+// dropped off, the lift parks out_of_service after its last car call.
+func SetLiftMaintenance(sessionID primitive.ObjectID, liftID primitive.ObjectID, outOfService bool) (*Lift, []*LiftRequest, error) {
+	if _, err := GetLift(sessionID, liftID); err != nil {
+		return nil, nil, err
+	}
+	if err := db.SetLiftMaintenance(liftID, outOfService); err != nil {
+		return nil, nil, err
+	}
+	TouchSession(sessionID)
+
+	var released []*LiftRequest
+	if outOfService {
+		stops, err := db.GetLiftStops(liftID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, stop := range stops {
+			if stop.Type != RequestHall {
+				continue
+			}
+			if err := db.ReleaseLiftRequest(stop); err != nil {
+				if err == ErrLiftRequestNotActive {
+					continue
+				}
+				return nil, released, err
+			}
+			released = append(released, stop)
+		}
+	}
+
+	lift, err := GetLift(sessionID, liftID)
+	if err != nil {
+		return nil, released, err
+	}
+	return lift, released, nil
+}
@@ -0,0 +1,502 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps everything in process memory, nothing survives a restart.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	sessions     map[primitive.ObjectID]*SessionDocument
+	lifts        map[primitive.ObjectID]*Lift
+	liftRequests map[primitive.ObjectID]*LiftRequest
+	passengers   map[primitive.ObjectID]*Passenger
+	// requestOrder, sessionOrder and passengerOrder keep listings in insertion
+	// order like a mongo collection scan.
+	requestOrder   []primitive.ObjectID
+	sessionOrder   []primitive.ObjectID
+	passengerOrder []primitive.ObjectID
+	// activeRequests counts the pending and queued requests of every session.
+	activeRequests map[primitive.ObjectID]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:       make(map[primitive.ObjectID]*SessionDocument),
+		lifts:          make(map[primitive.ObjectID]*Lift),
+		liftRequests:   make(map[primitive.ObjectID]*LiftRequest),
+		passengers:     make(map[primitive.ObjectID]*Passenger),
+		activeRequests: make(map[primitive.ObjectID]int),
+	}
+}
+
+func (store *MemoryStore) CreateSession(sessionDoc SessionDocument, lifts []Lift) (*Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sessionDoc.ID = primitive.NewObjectID()
+	sessionDoc.Lifts = nil
+	var insertedLifts []Lift
+	for _, lift := range lifts {
+		lift.ID = primitive.NewObjectID()
+		stored := lift
+		store.lifts[lift.ID] = &stored
+		sessionDoc.Lifts = append(sessionDoc.Lifts, lift.ID)
+		insertedLifts = append(insertedLifts, lift)
+	}
+	store.sessions[sessionDoc.ID] = &sessionDoc
+	store.sessionOrder = append(store.sessionOrder, sessionDoc.ID)
+
+	return sessionDoc.toSession(insertedLifts), nil
+}
+
+func (store *MemoryStore) GetSession(sessionID primitive.ObjectID) (*Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	sessionDoc, ok := store.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return store.session(sessionDoc), nil
+}
+
+func (store *MemoryStore) session(sessionDoc *SessionDocument) *Session {
+	var lifts []Lift
+	for _, liftID := range sessionDoc.Lifts {
+		if lift, ok := store.lifts[liftID]; ok {
+			lifts = append(lifts, *lift)
+		}
+	}
+	return sessionDoc.toSession(lifts)
+}
+
+func (store *MemoryStore) ListSessions(offset int, limit int) ([]*Session, int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var sessions []*Session
+	total := len(store.sessionOrder)
+	for i := total - 1 - offset; i >= 0 && len(sessions) < limit; i-- {
+		sessions = append(sessions, store.session(store.sessions[store.sessionOrder[i]]))
+	}
+	return sessions, int64(total), nil
+}
+
+func (store *MemoryStore) DeleteSession(sessionID primitive.ObjectID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sessionDoc, ok := store.sessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	for _, liftID := range sessionDoc.Lifts {
+		delete(store.lifts, liftID)
+	}
+	delete(store.sessions, sessionID)
+	delete(store.activeRequests, sessionID)
+	store.sessionOrder = removeID(store.sessionOrder, sessionID)
+
+	requestOrder := store.requestOrder[:0]
+	for _, requestID := range store.requestOrder {
+		if store.liftRequests[requestID].Session == sessionID {
+			delete(store.liftRequests, requestID)
+			continue
+		}
+		requestOrder = append(requestOrder, requestID)
+	}
+	store.requestOrder = requestOrder
+
+	passengerOrder := store.passengerOrder[:0]
+	for _, passengerID := range store.passengerOrder {
+		if store.passengers[passengerID].Session == sessionID {
+			delete(store.passengers, passengerID)
+			continue
+		}
+		passengerOrder = append(passengerOrder, passengerID)
+	}
+	store.passengerOrder = passengerOrder
+	return nil
+}
+
+func removeID(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+func (store *MemoryStore) TouchSession(sessionID primitive.ObjectID, at time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if sessionDoc, ok := store.sessions[sessionID]; ok {
+		sessionDoc.LastActivity = at
+	}
+	return nil
+}
+
+func (store *MemoryStore) GetIdleSessions(since time.Time) ([]primitive.ObjectID, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var sessionIDs []primitive.ObjectID
+	for _, sessionID := range store.sessionOrder {
+		if store.sessions[sessionID].LastActivity.Before(since) {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	return sessionIDs, nil
+}
+
+func (store *MemoryStore) CreateLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, stored := range store.liftRequests {
+		if !stored.Active || stored.Type != liftRequest.Type || stored.RequestedFloor != liftRequest.RequestedFloor {
+			continue
+		}
+		if liftRequest.Type == RequestCar && stored.Lift == liftRequest.Lift {
+			return ErrDuplicateLiftStop
+		}
+		if liftRequest.Type != RequestCar && stored.Session == liftRequest.Session && stored.Direction == liftRequest.Direction && sameDestination(stored.Destination, liftRequest.Destination) {
+			return ErrDuplicateLiftRequest
+		}
+	}
+
+	liftRequest.ID = primitive.NewObjectID()
+	liftRequest.Active = true
+	stored := *liftRequest
+	store.liftRequests[liftRequest.ID] = &stored
+	store.requestOrder = append(store.requestOrder, liftRequest.ID)
+	store.activeRequests[liftRequest.Session]++
+	return nil
+}
+
+// deactivate ends a pending or queued request with the given status.
+func (store *MemoryStore) deactivate(liftRequest *LiftRequest, status string) {
+	liftRequest.Status = status
+	liftRequest.Active = false
+	store.activeRequests[liftRequest.Session]--
+}
+
+func (store *MemoryStore) AssignLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.liftRequests[liftRequest.ID]
+	if !ok {
+		return ErrLiftRequestNotFound
+	}
+	if stored.Status != StatusPending {
+		return ErrLiftRequestNotActive
+	}
+	stored.Lift = liftRequest.Lift
+	stored.Status = liftRequest.Status
+	return nil
+}
+
+func (store *MemoryStore) CountActiveLiftRequests(sessionID primitive.ObjectID) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.activeRequests[sessionID], nil
+}
+
+func (store *MemoryStore) GetLiftRequests(sessionID primitive.ObjectID, status string) ([]*LiftRequest, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var results []*LiftRequest
+	for _, id := range store.requestOrder {
+		liftRequest := store.liftRequests[id]
+		if liftRequest.Status != status {
+			continue
+		}
+		if sessionID != primitive.NilObjectID && liftRequest.Session != sessionID {
+			continue
+		}
+		result := *liftRequest
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) GetLiftStops(liftID primitive.ObjectID) ([]*LiftRequest, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var results []*LiftRequest
+	for _, id := range store.requestOrder {
+		liftRequest := store.liftRequests[id]
+		if liftRequest.Lift == liftID && liftRequest.Status == StatusQueued {
+			result := *liftRequest
+			results = append(results, &result)
+		}
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) ClaimLift(liftID primitive.ObjectID, status string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	lift, ok := store.lifts[liftID]
+	if !ok {
+		return ErrLiftNotFound
+	}
+	if lift.Status != StatusIdle {
+		return ErrLiftTaken
+	}
+	lift.Status = status
+	return nil
+}
+
+func (store *MemoryStore) FreeLift(liftID primitive.ObjectID) (*Lift, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	lift, ok := store.lifts[liftID]
+	if !ok {
+		return nil, ErrLiftNotFound
+	}
+	lift.Status = StatusIdle
+	if lift.Maintenance {
+		lift.Status = StatusOutOfService
+	}
+	lift.Direction = DirectionNone
+	lift.DoorState = DoorClosed
+	freed := *lift
+	return &freed, nil
+}
+
+func (store *MemoryStore) SetLiftMaintenance(liftID primitive.ObjectID, maintenance bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	lift, ok := store.lifts[liftID]
+	if !ok {
+		return ErrLiftNotFound
+	}
+	lift.Maintenance = maintenance
+	if maintenance && lift.Status == StatusIdle {
+		lift.Status = StatusOutOfService
+	} else if !maintenance && lift.Status == StatusOutOfService {
+		lift.Status = StatusIdle
+	}
+	return nil
+}
+
+func (store *MemoryStore) UpdateLiftState(lift *Lift) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if stored, ok := store.lifts[lift.ID]; ok {
+		stored.CurrentFloor = lift.CurrentFloor
+		stored.Status = lift.Status
+		stored.Direction = lift.Direction
+		stored.DoorState = lift.DoorState
+		stored.SavedAt = lift.SavedAt
+	}
+	return nil
+}
+
+func (store *MemoryStore) GetClaimedLifts() ([]*Lift, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var results []*Lift
+	for _, sessionID := range store.sessionOrder {
+		for _, liftID := range store.sessions[sessionID].Lifts {
+			lift, ok := store.lifts[liftID]
+			if ok && lift.Status != StatusIdle && lift.Status != StatusOutOfService {
+				result := *lift
+				results = append(results, &result)
+			}
+		}
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) GetLiftSession(liftID primitive.ObjectID) (primitive.ObjectID, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, sessionID := range store.sessionOrder {
+		for _, id := range store.sessions[sessionID].Lifts {
+			if id == liftID {
+				return sessionID, nil
+			}
+		}
+	}
+	return primitive.NilObjectID, ErrSessionNotFound
+}
+
+func (store *MemoryStore) CompleteLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.liftRequests[liftRequest.ID]
+	if !ok {
+		return ErrLiftRequestNotFound
+	}
+	if stored.Status != StatusQueued {
+		return ErrLiftRequestNotActive
+	}
+	store.deactivate(stored, StatusCompleted)
+	return nil
+}
+
+func (store *MemoryStore) GetLiftRequest(requestID primitive.ObjectID) (*LiftRequest, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	liftRequest, ok := store.liftRequests[requestID]
+	if !ok {
+		return nil, ErrLiftRequestNotFound
+	}
+	result := *liftRequest
+	return &result, nil
+}
+
+func (store *MemoryStore) CancelLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.liftRequests[liftRequest.ID]
+	if !ok {
+		return ErrLiftRequestNotFound
+	}
+	if stored.Status != StatusQueued && stored.Status != StatusPending {
+		return ErrLiftRequestNotActive
+	}
+	store.deactivate(stored, StatusCancelled)
+	return nil
+}
+
+func (store *MemoryStore) ReleaseLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.liftRequests[liftRequest.ID]
+	if !ok {
+		return ErrLiftRequestNotFound
+	}
+	if stored.Status != StatusQueued {
+		return ErrLiftRequestNotActive
+	}
+	stored.Status = StatusPending
+	stored.Lift = primitive.NilObjectID
+	return nil
+}
+
+func (store *MemoryStore) SetEmergency(sessionID primitive.ObjectID, emergency Emergency) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sessionDoc, ok := store.sessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	sessionDoc.Emergency = emergency
+	return nil
+}
+
+func (store *MemoryStore) RecallLiftRequest(liftRequest *LiftRequest) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.liftRequests[liftRequest.ID]
+	if !ok {
+		return ErrLiftRequestNotFound
+	}
+	if stored.Status != StatusQueued && stored.Status != StatusPending {
+		return ErrLiftRequestNotActive
+	}
+	store.deactivate(stored, StatusRecalled)
+	return nil
+}
+
+func (store *MemoryStore) RecordLiftHistory(liftID primitive.ObjectID, entry HistoryEntry) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, liftRequest := range store.liftRequests {
+		if liftRequest.Lift == liftID && liftRequest.Status == StatusQueued {
+			liftRequest.History = append(liftRequest.History, entry)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) UpdateLiftLoad(lift *Lift) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if stored, ok := store.lifts[lift.ID]; ok {
+		stored.Passengers = lift.Passengers
+		stored.Load = lift.Load
+	}
+	return nil
+}
+
+func (store *MemoryStore) CreatePassenger(passenger *Passenger) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	passenger.ID = primitive.NewObjectID()
+	stored := *passenger
+	store.passengers[passenger.ID] = &stored
+	store.passengerOrder = append(store.passengerOrder, passenger.ID)
+	return nil
+}
+
+func (store *MemoryStore) GetPassengers(sessionID primitive.ObjectID, status string) ([]*Passenger, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var results []*Passenger
+	for _, passengerID := range store.passengerOrder {
+		passenger := store.passengers[passengerID]
+		if passenger.Session != sessionID || (status != "" && passenger.Status != status) {
+			continue
+		}
+		result := *passenger
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) GetLiftPassengers(liftID primitive.ObjectID) ([]*Passenger, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var results []*Passenger
+	for _, passengerID := range store.passengerOrder {
+		passenger := store.passengers[passengerID]
+		if passenger.Lift != liftID || passenger.Status != PassengerRiding {
+			continue
+		}
+		result := *passenger
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) UpdatePassenger(passenger *Passenger) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if stored, ok := store.passengers[passenger.ID]; ok {
+		stored.Status = passenger.Status
+		stored.Lift = passenger.Lift
+		stored.Leg = passenger.Leg
+	}
+	return nil
+}
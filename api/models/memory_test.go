@@ -0,0 +1,232 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestSession stores a session with the given number of idle lifts.
+func newTestSession(t *testing.T, store Store, lifts int) *Session {
+	t.Helper()
+	sessionDoc := SessionDocument{Floors: 10, MinFloor: 0, MaxFloor: 9, Kinematics: DefaultKinematics()}
+	liftDocs := make([]Lift, lifts)
+	for i := range liftDocs {
+		liftDocs[i] = Lift{Status: StatusIdle, DoorState: DoorClosed}
+	}
+	session, err := store.CreateSession(sessionDoc, liftDocs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func hallCall(session *Session, floor int, direction string) *LiftRequest {
+	return &LiftRequest{RequestedFloor: floor, Direction: direction, Type: RequestHall, Status: StatusPending, Session: session.ID}
+}
+
+// testStoreContract checks the behaviour every Store has to share.
+func testStoreContract(t *testing.T, newStore func() Store) {
+	t.Run("duplicate hall call", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+
+		if err := store.CreateLiftRequest(hallCall(session, 3, DirectionUp)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateLiftRequest(hallCall(session, 3, DirectionUp)); err != ErrDuplicateLiftRequest {
+			t.Fatalf("second call on the floor got %v, want ErrDuplicateLiftRequest", err)
+		}
+		if err := store.CreateLiftRequest(hallCall(session, 3, DirectionDown)); err != nil {
+			t.Fatalf("call the other way got %v", err)
+		}
+		other := newTestSession(t, store, 1)
+		if err := store.CreateLiftRequest(hallCall(other, 3, DirectionUp)); err != nil {
+			t.Fatalf("call in another session got %v", err)
+		}
+	})
+
+	t.Run("duplicate car call", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 2)
+		carCall := func(lift Lift) *LiftRequest {
+			return &LiftRequest{RequestedFloor: 5, Type: RequestCar, Status: StatusQueued, Lift: lift.ID, Session: session.ID}
+		}
+
+		if err := store.CreateLiftRequest(carCall(session.Lifts[0])); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateLiftRequest(carCall(session.Lifts[0])); err != ErrDuplicateLiftStop {
+			t.Fatalf("second stop on the floor got %v, want ErrDuplicateLiftStop", err)
+		}
+		if err := store.CreateLiftRequest(carCall(session.Lifts[1])); err != nil {
+			t.Fatalf("stop of another lift got %v", err)
+		}
+	})
+
+	t.Run("claim and free", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+		liftID := session.Lifts[0].ID
+
+		if err := store.ClaimLift(liftID, StatusMovingUp); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ClaimLift(liftID, StatusMovingDown); err != ErrLiftTaken {
+			t.Fatalf("claiming a claimed lift got %v, want ErrLiftTaken", err)
+		}
+		lift, err := store.FreeLift(liftID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lift.Status != StatusIdle || lift.Direction != DirectionNone || lift.DoorState != DoorClosed {
+			t.Fatalf("freed lift is %v heading %v with doors %v, want idle", lift.Status, lift.Direction, lift.DoorState)
+		}
+		if err := store.ClaimLift(liftID, StatusMovingUp); err != nil {
+			t.Fatalf("claiming a freed lift got %v", err)
+		}
+		if err := store.ClaimLift(primitive.NewObjectID(), StatusMovingUp); err != ErrLiftNotFound {
+			t.Fatalf("claiming an unknown lift got %v, want ErrLiftNotFound", err)
+		}
+	})
+
+	t.Run("free under maintenance", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+		liftID := session.Lifts[0].ID
+
+		if err := store.ClaimLift(liftID, StatusMovingUp); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetLiftMaintenance(liftID, true); err != nil {
+			t.Fatal(err)
+		}
+		lift, err := store.FreeLift(liftID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lift.Status != StatusOutOfService {
+			t.Fatalf("freed lift under maintenance is %v, want %v", lift.Status, StatusOutOfService)
+		}
+		if err := store.ClaimLift(liftID, StatusMovingUp); err != ErrLiftTaken {
+			t.Fatalf("claiming an out of service lift got %v, want ErrLiftTaken", err)
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+		liftRequest := hallCall(session, 4, DirectionDown)
+		liftRequest.Status = StatusQueued
+		liftRequest.Lift = session.Lifts[0].ID
+		if err := store.CreateLiftRequest(liftRequest); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.CompleteLiftRequest(liftRequest); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompleteLiftRequest(liftRequest); err != ErrLiftRequestNotActive {
+			t.Fatalf("completing twice got %v, want ErrLiftRequestNotActive", err)
+		}
+		if err := store.CancelLiftRequest(liftRequest); err != ErrLiftRequestNotActive {
+			t.Fatalf("cancelling a completed request got %v, want ErrLiftRequestNotActive", err)
+		}
+		stored, err := store.GetLiftRequest(liftRequest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != StatusCompleted {
+			t.Fatalf("request is %v, want %v", stored.Status, StatusCompleted)
+		}
+		if err := store.CreateLiftRequest(hallCall(session, 4, DirectionDown)); err != nil {
+			t.Fatalf("calling again after completion got %v", err)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+		liftRequest := hallCall(session, 2, DirectionUp)
+		if err := store.CreateLiftRequest(liftRequest); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.CompleteLiftRequest(liftRequest); err != ErrLiftRequestNotActive {
+			t.Fatalf("completing a pending request got %v, want ErrLiftRequestNotActive", err)
+		}
+		if err := store.CancelLiftRequest(liftRequest); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CancelLiftRequest(liftRequest); err != ErrLiftRequestNotActive {
+			t.Fatalf("cancelling twice got %v, want ErrLiftRequestNotActive", err)
+		}
+		pending, err := store.GetLiftRequests(session.ID, StatusPending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 0 {
+			t.Fatalf("%d requests still pending after the cancel", len(pending))
+		}
+		if err := store.CreateLiftRequest(hallCall(session, 2, DirectionUp)); err != nil {
+			t.Fatalf("calling again after the cancel got %v", err)
+		}
+	})
+
+	t.Run("count active", func(t *testing.T) {
+		store := newStore()
+		session := newTestSession(t, store, 1)
+		countIs := func(want int) {
+			t.Helper()
+			count, err := store.CountActiveLiftRequests(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != want {
+				t.Fatalf("%d active requests, want %d", count, want)
+			}
+		}
+
+		requests := []*LiftRequest{hallCall(session, 1, DirectionUp), hallCall(session, 2, DirectionUp), hallCall(session, 3, DirectionUp)}
+		for _, liftRequest := range requests {
+			if err := store.CreateLiftRequest(liftRequest); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store.CreateLiftRequest(hallCall(session, 1, DirectionUp))
+		countIs(3)
+
+		requests[0].Status = StatusQueued
+		requests[0].Lift = session.Lifts[0].ID
+		if err := store.AssignLiftRequest(requests[0]); err != nil {
+			t.Fatal(err)
+		}
+		countIs(3)
+		if err := store.CompleteLiftRequest(requests[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CancelLiftRequest(requests[1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RecallLiftRequest(requests[2]); err != nil {
+			t.Fatal(err)
+		}
+		store.CancelLiftRequest(requests[2])
+		countIs(0)
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		store := newStore()
+		unknown := &LiftRequest{ID: primitive.NewObjectID()}
+		if _, err := store.GetLiftRequest(unknown.ID); err != ErrLiftRequestNotFound {
+			t.Fatalf("got %v, want ErrLiftRequestNotFound", err)
+		}
+		if err := store.CancelLiftRequest(unknown); err != ErrLiftRequestNotFound {
+			t.Fatalf("cancel got %v, want ErrLiftRequestNotFound", err)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStoreContract(t, func() Store { return NewMemoryStore() })
+}
@@ -0,0 +1,591 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoStore struct {
+	liftCollection        *mongo.Collection
+	liftRequestCollection *mongo.Collection
+	sessionCollection     *mongo.Collection
+	passengerCollection   *mongo.Collection
+}
+
+// storeError turns a driver error into a typed one, connection trouble makes
+// the store unavailable while anything else is unexpected.
+func storeError(err error) error {
+	var typed *utils.Error
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return utils.Unavailable(err, "database is unavailable, try again later")
+	}
+	return utils.Internal(err)
+}
+
+func NewMongoStore() *MongoStore {
+	connectionString := os.Getenv("DB_URI")
+	dbName := os.Getenv("DB_NAME")
+	liftCollName := os.Getenv("DB_LIFT_COLLECTION_NAME")
+	liftRequestCollName := os.Getenv("DB_LIFT_REQUEST_COLLECTION_NAME")
+	sessionCollName := os.Getenv("DB_SESSION_COLLECTION_NAME")
+	passengerCollName := os.Getenv("DB_PASSENGER_COLLECTION_NAME")
+	if passengerCollName == "" {
+		passengerCollName = "passengers"
+	}
+
+	clientOptions := options.Client().ApplyURI(connectionString)
+
+	client, err := mongo.Connect(context.TODO(), clientOptions)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = client.Ping(context.TODO(), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Connected to mongodb")
+
+	store := &MongoStore{
+		liftCollection:        client.Database(dbName).Collection(liftCollName),
+		liftRequestCollection: client.Database(dbName).Collection(liftRequestCollName),
+		sessionCollection:     client.Database(dbName).Collection(sessionCollName),
+		passengerCollection:   client.Database(dbName).Collection(passengerCollName),
+	}
+	if err := store.createIndexes(); err != nil {
+		log.Fatal(err)
+	}
+	return store
+}
+
+// createIndexes makes the database reject a second active hall call for the
+// same floor, direction and destination of a session and a second stop on the
+// same floor of a lift, concurrent calls can't both pass a check done in code.
+// The active requests of a session are counted from an index too.
+func (store *MongoStore) createIndexes() error {
+	_, err := store.liftRequestCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "session", Value: 1}, {Key: "requestedfloor", Value: 1}, {Key: "direction", Value: 1}, {Key: "destination", Value: 1}},
+			Options: options.Index().
+				SetName("active_hall_call_destination").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active": true, "type": RequestHall}),
+		},
+		{
+			Keys: bson.D{{Key: "lift", Value: 1}, {Key: "requestedfloor", Value: 1}},
+			Options: options.Index().
+				SetName("active_car_call").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"active": true, "type": RequestCar}),
+		},
+		{
+			Keys:    bson.D{{Key: "session", Value: 1}, {Key: "active", Value: 1}},
+			Options: options.Index().SetName("session_active"),
+		},
+	})
+	return err
+}
+
+func (store *MongoStore) ClaimLift(liftID primitive.ObjectID, status string) error {
+	result, err := store.liftCollection.UpdateOne(context.TODO(), bson.M{"_id": liftID, "status": StatusIdle, "maintenance": bson.M{"$ne": true}}, bson.M{"$set": bson.M{
+		"status": status,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftTaken
+	}
+	return nil
+}
+
+func (store *MongoStore) CreateSession(sessionDoc SessionDocument, lifts []Lift) (*Session, error) {
+	var interfacesObjs []interface{}
+	for _, lift := range lifts {
+		interfacesObjs = append(interfacesObjs, lift)
+	}
+
+	liftResults, err := store.liftCollection.InsertMany(context.Background(), interfacesObjs)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	// Create a slice to store the inserted lift IDs.
+	var insertedLiftIDs []primitive.ObjectID
+	for _, result := range liftResults.InsertedIDs {
+		insertedLiftIDs = append(insertedLiftIDs, result.(primitive.ObjectID))
+	}
+
+	var insertedLifts []Lift
+	for i, id := range insertedLiftIDs {
+		lift := lifts[i]
+		lift.ID = id
+		insertedLifts = append(insertedLifts, lift)
+	}
+
+	// Create the Session object with the inserted lift IDs.
+	sessionDoc.Lifts = insertedLiftIDs
+	result, err := store.sessionCollection.InsertOne(context.Background(), sessionDoc)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	sessionDoc.ID = result.InsertedID.(primitive.ObjectID)
+
+	return sessionDoc.toSession(insertedLifts), nil
+}
+
+func (store *MongoStore) GetSession(sessionID primitive.ObjectID) (*Session, error) {
+	sessionFilter := bson.M{"_id": sessionID}
+	var sessionDoc SessionDocument
+
+	err := store.sessionCollection.FindOne(context.TODO(), sessionFilter).Decode(&sessionDoc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSessionNotFound
+		}
+		return nil, storeError(err)
+	}
+
+	lifts, err := store.findLifts(sessionDoc.Lifts)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return sessionDoc.toSession(lifts), nil
+}
+
+// findLifts loads the lifts with the given ids, in the order of the ids.
+func (store *MongoStore) findLifts(liftIds []primitive.ObjectID) ([]Lift, error) {
+	liftFilter := bson.M{"_id": bson.M{"$in": append([]primitive.ObjectID{}, liftIds...)}}
+
+	liftCursor, err := store.liftCollection.Find(context.TODO(), liftFilter)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer liftCursor.Close(context.TODO())
+
+	liftsByID := make(map[primitive.ObjectID]Lift)
+	for liftCursor.Next(context.TODO()) {
+		var doc Lift
+		if err := liftCursor.Decode(&doc); err != nil {
+			return nil, storeError(err)
+		}
+		liftsByID[doc.ID] = doc
+	}
+	if err := liftCursor.Err(); err != nil {
+		return nil, storeError(err)
+	}
+
+	var lifts []Lift
+	for _, id := range liftIds {
+		if lift, ok := liftsByID[id]; ok {
+			lifts = append(lifts, lift)
+		}
+	}
+	return lifts, nil
+}
+
+func (store *MongoStore) ListSessions(offset int, limit int) ([]*Session, int64, error) {
+	total, err := store.sessionCollection.CountDocuments(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, 0, storeError(err)
+	}
+
+	findOptions := options.Find().SetSort(bson.M{"_id": -1}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	curr, err := store.sessionCollection.Find(context.TODO(), bson.M{}, findOptions)
+	if err != nil {
+		return nil, 0, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var sessionDocs []SessionDocument
+	if err := curr.All(context.TODO(), &sessionDocs); err != nil {
+		return nil, 0, storeError(err)
+	}
+
+	var sessions []*Session
+	for _, sessionDoc := range sessionDocs {
+		lifts, err := store.findLifts(sessionDoc.Lifts)
+		if err != nil {
+			return nil, 0, storeError(err)
+		}
+		sessions = append(sessions, sessionDoc.toSession(lifts))
+	}
+	return sessions, total, nil
+}
+
+func (store *MongoStore) DeleteSession(sessionID primitive.ObjectID) error {
+	var sessionDoc SessionDocument
+	err := store.sessionCollection.FindOneAndDelete(context.TODO(), bson.M{"_id": sessionID}).Decode(&sessionDoc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrSessionNotFound
+		}
+		return storeError(err)
+	}
+
+	if _, err := store.liftCollection.DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": sessionDoc.Lifts}}); err != nil {
+		return storeError(err)
+	}
+	if _, err := store.liftRequestCollection.DeleteMany(context.TODO(), bson.M{"session": sessionID}); err != nil {
+		return storeError(err)
+	}
+	if _, err := store.passengerCollection.DeleteMany(context.TODO(), bson.M{"session": sessionID}); err != nil {
+		return storeError(err)
+	}
+	fmt.Printf("Deleted Session: %+v\n", sessionID.Hex())
+	return nil
+}
+
+func (store *MongoStore) TouchSession(sessionID primitive.ObjectID, at time.Time) error {
+	_, err := store.sessionCollection.UpdateOne(context.TODO(), bson.M{"_id": sessionID}, bson.M{"$set": bson.M{
+		"lastactivity": at,
+	}})
+	return storeError(err)
+}
+
+func (store *MongoStore) GetIdleSessions(since time.Time) ([]primitive.ObjectID, error) {
+	// Sessions created before activity was tracked have no lastactivity at all.
+	sessionFilter := bson.M{"$or": []bson.M{
+		{"lastactivity": bson.M{"$lt": since}},
+		{"lastactivity": bson.M{"$exists": false}},
+	}}
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1})
+	curr, err := store.sessionCollection.Find(context.TODO(), sessionFilter, findOptions)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var sessionIDs []primitive.ObjectID
+	for curr.Next(context.TODO()) {
+		var sessionDoc SessionDocument
+		if err := curr.Decode(&sessionDoc); err != nil {
+			return nil, storeError(err)
+		}
+		sessionIDs = append(sessionIDs, sessionDoc.ID)
+	}
+	return sessionIDs, storeError(curr.Err())
+}
+
+func (store *MongoStore) CreateLiftRequest(liftRequest *LiftRequest) error {
+	liftRequest.Active = true
+	result, err := store.liftRequestCollection.InsertOne(context.TODO(), liftRequest)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) && liftRequest.Type == RequestCar {
+			return ErrDuplicateLiftStop
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateLiftRequest
+		}
+		return storeError(err)
+	}
+	liftRequest.ID = result.InsertedID.(primitive.ObjectID)
+	fmt.Printf("Created LiftRequest: %+v\n", liftRequest.ID.Hex())
+
+	return nil
+}
+
+func (store *MongoStore) AssignLiftRequest(liftRequest *LiftRequest) error {
+	result, err := store.liftRequestCollection.UpdateOne(context.TODO(), bson.M{"_id": liftRequest.ID, "status": StatusPending}, bson.M{"$set": bson.M{
+		"lift": liftRequest.Lift, "status": liftRequest.Status,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftRequestNotActive
+	}
+	fmt.Printf("Assigned lift %v to LiftRequest: %+v\n", liftRequest.Lift.Hex(), liftRequest.ID.Hex())
+
+	return nil
+}
+
+func (store *MongoStore) GetLiftRequests(sessionID primitive.ObjectID, status string) ([]*LiftRequest, error) {
+	liftRequestsFilters := bson.M{}
+	liftRequestsFilters["status"] = status
+	if sessionID != primitive.NilObjectID {
+		liftRequestsFilters["session"] = sessionID
+	}
+
+	curr, err := store.liftRequestCollection.Find(context.TODO(), liftRequestsFilters)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var results []*LiftRequest
+	for curr.Next(context.TODO()) {
+		var result LiftRequest
+		if err := curr.Decode(&result); err != nil {
+			return nil, storeError(err)
+		}
+		results = append(results, &result)
+	}
+
+	if err := curr.Err(); err != nil {
+		return nil, storeError(err)
+	}
+
+	return results, nil
+}
+
+func (store *MongoStore) CountActiveLiftRequests(sessionID primitive.ObjectID) (int, error) {
+	count, err := store.liftRequestCollection.CountDocuments(context.TODO(), bson.M{"session": sessionID, "active": true})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	return int(count), nil
+}
+
+func (store *MongoStore) GetLiftStops(liftID primitive.ObjectID) ([]*LiftRequest, error) {
+	findOptions := options.Find().SetSort(bson.M{"_id": 1})
+	curr, err := store.liftRequestCollection.Find(context.TODO(), bson.M{"lift": liftID, "status": StatusQueued}, findOptions)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var results []*LiftRequest
+	if err := curr.All(context.TODO(), &results); err != nil {
+		return nil, storeError(err)
+	}
+	return results, nil
+}
+
+func (store *MongoStore) FreeLift(liftID primitive.ObjectID) (*Lift, error) {
+	// The status follows from the maintenance flag inside the update, a lift
+	// taken out of service while it is being freed is never left idle.
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"status":    bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$maintenance", true}}, StatusOutOfService, StatusIdle}},
+		"direction": DirectionNone,
+		"doorstate": DoorClosed,
+	}}}}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var lift Lift
+	err := store.liftCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": liftID}, update, findOptions).Decode(&lift)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLiftNotFound
+		}
+		return nil, storeError(err)
+	}
+	return &lift, nil
+}
+
+func (store *MongoStore) SetLiftMaintenance(liftID primitive.ObjectID, maintenance bool) error {
+	// The flag and the status change in one update, a claim can't slip in
+	// between them and dispatch a lift that is going out of service.
+	from, to := StatusIdle, StatusOutOfService
+	if !maintenance {
+		from, to = StatusOutOfService, StatusIdle
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"maintenance": maintenance,
+		"status":      bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", from}}, to, "$status"}},
+	}}}}
+
+	result, err := store.liftCollection.UpdateOne(context.TODO(), bson.M{"_id": liftID}, update)
+	if err != nil {
+		return storeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrLiftNotFound
+	}
+	return nil
+}
+
+func (store *MongoStore) UpdateLiftState(lift *Lift) error {
+	_, err := store.liftCollection.UpdateOne(context.TODO(), bson.M{"_id": lift.ID}, bson.M{"$set": bson.M{
+		"currentfloor": lift.CurrentFloor, "status": lift.Status, "direction": lift.Direction, "doorstate": lift.DoorState, "savedat": lift.SavedAt,
+	}})
+	return storeError(err)
+}
+
+func (store *MongoStore) GetClaimedLifts() ([]*Lift, error) {
+	filter := bson.M{"status": bson.M{"$nin": []string{StatusIdle, StatusOutOfService}}}
+	curr, err := store.liftCollection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var results []*Lift
+	if err := curr.All(context.TODO(), &results); err != nil {
+		return nil, storeError(err)
+	}
+	return results, nil
+}
+
+func (store *MongoStore) GetLiftSession(liftID primitive.ObjectID) (primitive.ObjectID, error) {
+	var sessionDoc SessionDocument
+	err := store.sessionCollection.FindOne(context.TODO(), bson.M{"lifts": liftID}).Decode(&sessionDoc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrSessionNotFound
+		}
+		return primitive.NilObjectID, storeError(err)
+	}
+	return sessionDoc.ID, nil
+}
+
+func (store *MongoStore) CompleteLiftRequest(liftRequest *LiftRequest) error {
+	liftRequestFilter := bson.M{"_id": liftRequest.ID, "status": StatusQueued}
+	updatedLiftRequest := bson.M{"$set": bson.M{
+		"status": StatusCompleted, "active": false,
+	}}
+
+	result, err := store.liftRequestCollection.UpdateOne(context.TODO(), liftRequestFilter, updatedLiftRequest)
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftRequestNotActive
+	}
+	fmt.Printf("Update document successfully LiftRequest: %+v\n", liftRequest.ID.Hex())
+
+	return nil
+}
+
+func (store *MongoStore) GetLiftRequest(requestID primitive.ObjectID) (*LiftRequest, error) {
+	var liftRequest LiftRequest
+	err := store.liftRequestCollection.FindOne(context.TODO(), bson.M{"_id": requestID}).Decode(&liftRequest)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrLiftRequestNotFound
+		}
+		return nil, storeError(err)
+	}
+	return &liftRequest, nil
+}
+
+func (store *MongoStore) CancelLiftRequest(liftRequest *LiftRequest) error {
+	liftRequestFilter := bson.M{"_id": liftRequest.ID, "status": bson.M{"$in": []string{StatusQueued, StatusPending}}}
+	result, err := store.liftRequestCollection.UpdateOne(context.TODO(), liftRequestFilter, bson.M{"$set": bson.M{
+		"status": StatusCancelled, "active": false,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftRequestNotActive
+	}
+	fmt.Printf("Cancelled LiftRequest: %+v\n", liftRequest.ID.Hex())
+
+	return nil
+}
+
+func (store *MongoStore) ReleaseLiftRequest(liftRequest *LiftRequest) error {
+	result, err := store.liftRequestCollection.UpdateOne(context.TODO(), bson.M{"_id": liftRequest.ID, "status": StatusQueued}, bson.M{"$set": bson.M{
+		"lift": primitive.NilObjectID, "status": StatusPending,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftRequestNotActive
+	}
+	fmt.Printf("Released LiftRequest: %+v\n", liftRequest.ID.Hex())
+
+	return nil
+}
+
+func (store *MongoStore) SetEmergency(sessionID primitive.ObjectID, emergency Emergency) error {
+	result, err := store.sessionCollection.UpdateOne(context.TODO(), bson.M{"_id": sessionID}, bson.M{"$set": bson.M{
+		"emergency": emergency,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (store *MongoStore) RecallLiftRequest(liftRequest *LiftRequest) error {
+	liftRequestFilter := bson.M{"_id": liftRequest.ID, "status": bson.M{"$in": []string{StatusQueued, StatusPending}}}
+	result, err := store.liftRequestCollection.UpdateOne(context.TODO(), liftRequestFilter, bson.M{"$set": bson.M{
+		"status": StatusRecalled, "active": false,
+	}})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.ModifiedCount == 0 {
+		return ErrLiftRequestNotActive
+	}
+	return nil
+}
+
+func (store *MongoStore) RecordLiftHistory(liftID primitive.ObjectID, entry HistoryEntry) error {
+	_, err := store.liftRequestCollection.UpdateMany(context.TODO(), bson.M{"lift": liftID, "status": StatusQueued}, bson.M{"$push": bson.M{
+		"history": entry,
+	}})
+	return storeError(err)
+}
+
+func (store *MongoStore) UpdateLiftLoad(lift *Lift) error {
+	_, err := store.liftCollection.UpdateOne(context.TODO(), bson.M{"_id": lift.ID}, bson.M{"$set": bson.M{
+		"passengers": lift.Passengers, "load": lift.Load,
+	}})
+	return storeError(err)
+}
+
+func (store *MongoStore) CreatePassenger(passenger *Passenger) error {
+	result, err := store.passengerCollection.InsertOne(context.TODO(), passenger)
+	if err != nil {
+		return storeError(err)
+	}
+	passenger.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (store *MongoStore) GetPassengers(sessionID primitive.ObjectID, status string) ([]*Passenger, error) {
+	passengerFilter := bson.M{"session": sessionID}
+	if status != "" {
+		passengerFilter["status"] = status
+	}
+	return store.findPassengers(passengerFilter)
+}
+
+func (store *MongoStore) GetLiftPassengers(liftID primitive.ObjectID) ([]*Passenger, error) {
+	return store.findPassengers(bson.M{"lift": liftID, "status": PassengerRiding})
+}
+
+func (store *MongoStore) findPassengers(passengerFilter bson.M) ([]*Passenger, error) {
+	findOptions := options.Find().SetSort(bson.M{"_id": 1})
+	curr, err := store.passengerCollection.Find(context.TODO(), passengerFilter, findOptions)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer curr.Close(context.TODO())
+
+	var results []*Passenger
+	if err := curr.All(context.TODO(), &results); err != nil {
+		return nil, storeError(err)
+	}
+	return results, nil
+}
+
+func (store *MongoStore) UpdatePassenger(passenger *Passenger) error {
+	_, err := store.passengerCollection.UpdateOne(context.TODO(), bson.M{"_id": passenger.ID}, bson.M{"$set": bson.M{
+		"status": passenger.Status, "lift": passenger.Lift, "leg": passenger.Leg,
+	}})
+	return storeError(err)
+}
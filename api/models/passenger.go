@@ -0,0 +1,392 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Capacity limits what a lift carries, a limit left at zero doesn't apply.
+type Capacity struct {
+	Persons int     `json:"persons"`
+	Kg      float64 `json:"kg"`
+}
+
+// DefaultPassengerWeight is the weight, in kg, of a passenger that didn't give
+// one. A lift is full once a passenger of that weight no longer fits.
+const DefaultPassengerWeight = 75.0
+
+const (
+	PassengerWaiting   = "waiting"
+	PassengerRiding    = "riding"
+	PassengerDelivered = "delivered"
+	PassengerCancelled = "cancelled"
+	// PassengerEvacuated is the status of the passengers an emergency recall
+	// sent out of the building, from the hall or the evacuation floor.
+	PassengerEvacuated = "evacuated"
+)
+
+// Passenger is someone travelling from their origin to their destination. They
+// wait at the hall until a lift serving their hall call has room for them,
+// ride it and get off on their destination. A trip with a Transfer is made in
+// two legs, the passenger changes lifts at the sky lobby.
+type Passenger struct {
+	ID          primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Session     primitive.ObjectID `json:"session"`
+	Origin      int                `json:"origin"`
+	Destination int                `json:"destination"`
+	Transfer    *int               `json:"transfer,omitempty"`
+	// Leg is 0 until the passenger gets off at the sky lobby, 1 from then on.
+	Leg    int     `json:"leg"`
+	Weight float64 `json:"weight"`
+	// Lift is the lift the passenger boarded.
+	Lift   primitive.ObjectID `json:"lift"`
+	Status string             `json:"status"`
+}
+
+type PassengerResponse struct {
+	*Passenger
+	// Call is the hall call the passenger waits on, its lift is the one to board.
+	Call *LiftRequestResponse `json:"call"`
+}
+
+// Arrival is what happens when a lift opens its doors on a floor.
+type Arrival struct {
+	// Served are the requests the lift stopped for, Heading the way it goes on.
+	Served   []*LiftRequest
+	Heading  string
+	Alighted []*Passenger
+	Boarded  []*Passenger
+	// Transferred got off at a sky lobby, they need a lift for their second leg.
+	Transferred []*Passenger
+	// Lift holds the passengers and load after everyone got on and off.
+	Lift *Lift
+}
+
+func ValidatePassengerStatus(status string) error {
+	switch strings.ToLower(status) {
+	case PassengerWaiting, PassengerRiding, PassengerDelivered, PassengerCancelled, PassengerEvacuated:
+		return nil
+	default:
+		return fmt.Errorf("invalid status, valid status are %v, %v, %v, %v, %v", PassengerWaiting, PassengerRiding, PassengerDelivered, PassengerCancelled, PassengerEvacuated)
+	}
+}
+
+// From and To are the floors of the leg the passenger is on.
+func (passenger *Passenger) From() int {
+	if passenger.Transfer != nil && passenger.Leg > 0 {
+		return *passenger.Transfer
+	}
+	return passenger.Origin
+}
+
+func (passenger *Passenger) To() int {
+	if passenger.Transfer != nil && passenger.Leg == 0 {
+		return *passenger.Transfer
+	}
+	return passenger.Destination
+}
+
+// direction is the way the passenger travels, the direction of their hall call.
+func (passenger *Passenger) direction() string {
+	return headingTowards(passenger.From(), passenger.To())
+}
+
+// waitsOn tells whether the passenger is waiting for the hall call, the one on
+// their floor going their way and, in destination dispatch, to their floor.
+func (passenger *Passenger) waitsOn(liftRequest *LiftRequest) bool {
+	if liftRequest.Type != RequestHall || passenger.Status != PassengerWaiting {
+		return false
+	}
+	if passenger.From() != liftRequest.RequestedFloor || passenger.direction() != liftRequest.Direction {
+		return false
+	}
+	return liftRequest.Destination == nil || *liftRequest.Destination == passenger.To()
+}
+
+// fits tells whether a passenger of the weight can get on the lift.
+func (lift *Lift) fits(weight float64) bool {
+	if lift.Capacity.Persons > 0 && lift.Passengers >= lift.Capacity.Persons {
+		return false
+	}
+	return lift.Capacity.Kg <= 0 || lift.Load+weight <= lift.Capacity.Kg
+}
+
+// full tells whether the lift is at capacity, a full lift passes hall calls by.
+func (lift *Lift) full() bool {
+	return !lift.fits(DefaultPassengerWeight)
+}
+
+// takesHallCalls tells whether the lift picks anyone up, a full lift or one
+// under maintenance only drops its riders off.
+func (lift *Lift) takesHallCalls() bool {
+	return !lift.Maintenance && !lift.full()
+}
+
+// carStops leaves out the hall calls, the stops a full lift still makes.
+func carStops(stops []*LiftRequest) []*LiftRequest {
+	var filtered []*LiftRequest
+	for _, stop := range stops {
+		if stop.Type == RequestCar {
+			filtered = append(filtered, stop)
+		}
+	}
+	return filtered
+}
+
+// CreatePassenger puts a passenger on the floor and calls a lift for them. A
+// passenger joins the hall call already made for their trip.
+func CreatePassenger(sessionID string, origin int, destination int, weight float64) (*LiftRequest, *PassengerResponse, error) {
+	session, err := GetSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := session.checkNoEmergency(); err != nil {
+		return nil, nil, err
+	}
+	transfer, err := session.planTransfer(origin, destination)
+	if err != nil {
+		return nil, nil, err
+	}
+	if weight == 0 {
+		weight = DefaultPassengerWeight
+	}
+
+	// The passenger waits before the call is made, so a lift answering it right
+	// away finds them.
+	passenger := &Passenger{Session: session.ID, Origin: origin, Destination: destination, Transfer: transfer, Weight: weight, Status: PassengerWaiting}
+	if err := db.CreatePassenger(passenger); err != nil {
+		return nil, nil, err
+	}
+
+	liftRequest, response, err := callLift(session, passenger)
+	if err != nil {
+		passenger.Status = PassengerCancelled
+		db.UpdatePassenger(passenger)
+		return nil, nil, err
+	}
+	return liftRequest, &PassengerResponse{Passenger: passenger, Call: response}, nil
+}
+
+// CallLift makes the hall call of a passenger that changed to their second
+// leg at a sky lobby.
+func CallLift(sessionID primitive.ObjectID, passenger *Passenger) (*LiftRequest, error) {
+	session, err := db.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	liftRequest, _, err := callLift(session, passenger)
+	return liftRequest, err
+}
+
+// callLift makes the hall call for the leg the passenger is on.
+func callLift(session *Session, passenger *Passenger) (*LiftRequest, *LiftRequestResponse, error) {
+	var to *int
+	if session.DispatchMode == DispatchDestination {
+		legTo := passenger.To()
+		to = &legTo
+	}
+	liftRequest, response, err := CreateLiftRequest(passenger.From(), passenger.direction(), to, session.ID.Hex())
+	if err == ErrDuplicateLiftRequest {
+		liftRequest, response, err = joinLiftRequest(session, &LiftRequest{RequestedFloor: passenger.From(), Direction: passenger.direction(), Destination: to})
+	}
+	return liftRequest, response, err
+}
+
+// waitingDestinations lists where the passengers waiting on the hall call go,
+// the lift taking the call has to serve one of them.
+func waitingDestinations(liftRequest *LiftRequest) ([]int, error) {
+	if liftRequest.Type != RequestHall {
+		return nil, nil
+	}
+	waiting, err := db.GetPassengers(liftRequest.Session, PassengerWaiting)
+	if err != nil {
+		return nil, err
+	}
+	var destinations []int
+	for _, passenger := range waiting {
+		if passenger.waitsOn(liftRequest) {
+			destinations = append(destinations, passenger.To())
+		}
+	}
+	return destinations, nil
+}
+
+func GetPassengers(sessionID string, status string) ([]*Passenger, error) {
+	sessionObjectID, err := ParseID(sessionID, "session")
+	if err != nil {
+		return nil, err
+	}
+	if status != "" {
+		if err := ValidatePassengerStatus(status); err != nil {
+			return nil, err
+		}
+	}
+	return db.GetPassengers(sessionObjectID, strings.ToLower(status))
+}
+
+// ArriveAt opens the doors of the lift on the floor. Riders going there get
+// off first, then the waiting passengers of the hall calls served get on while
+// there is room. A full lift, or one under maintenance, serves none of its hall
+// calls. On the evacuation floor of a recall everyone gets off.
+func ArriveAt(sessionID primitive.ObjectID, liftID primitive.ObjectID, floor int, heading string) (*Arrival, error) {
+	session, err := db.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	lift := findLift(session, liftID)
+	if lift == nil {
+		return nil, ErrLiftNotFound
+	}
+	arrival := &Arrival{Heading: heading, Lift: lift}
+
+	if session.Emergency.Active && floor == session.Emergency.Floor {
+		if err := evacuate(lift, arrival); err != nil {
+			return nil, err
+		}
+		if len(arrival.Alighted) > 0 {
+			if err := db.UpdateLiftLoad(lift); err != nil {
+				return nil, err
+			}
+		}
+		return arrival, nil
+	}
+
+	riders, err := db.GetLiftPassengers(liftID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rider := range riders {
+		if rider.To() != floor {
+			continue
+		}
+		rider.Status = PassengerDelivered
+		if rider.Transfer != nil && rider.Leg == 0 {
+			rider.Status = PassengerWaiting
+			rider.Leg = 1
+			rider.Lift = primitive.NilObjectID
+			arrival.Transferred = append(arrival.Transferred, rider)
+		}
+		if err := db.UpdatePassenger(rider); err != nil {
+			return nil, err
+		}
+		lift.Passengers--
+		lift.Load -= rider.Weight
+		arrival.Alighted = append(arrival.Alighted, rider)
+	}
+
+	stops, err := db.GetLiftStops(liftID)
+	if err != nil {
+		return nil, err
+	}
+	if !lift.takesHallCalls() {
+		stops = carStops(stops)
+	}
+	arrival.Served, arrival.Heading = serveAt(floor, heading, stops)
+
+	var waiting []*Passenger
+	for _, liftRequest := range arrival.Served {
+		if liftRequest.Type == RequestHall && waiting == nil {
+			if waiting, err = db.GetPassengers(sessionID, PassengerWaiting); err != nil {
+				return nil, err
+			}
+		}
+		for _, passenger := range waiting {
+			if !passenger.waitsOn(liftRequest) || !lift.servesFloor(passenger.To()) || !lift.fits(passenger.Weight) {
+				continue
+			}
+			passenger.Status = PassengerRiding
+			passenger.Lift = liftID
+			if err := db.UpdatePassenger(passenger); err != nil {
+				return nil, err
+			}
+			lift.Passengers++
+			lift.Load += passenger.Weight
+			arrival.Boarded = append(arrival.Boarded, passenger)
+		}
+	}
+
+	if len(arrival.Alighted) > 0 || len(arrival.Boarded) > 0 {
+		if err := db.UpdateLiftLoad(lift); err != nil {
+			return nil, err
+		}
+	}
+	return arrival, nil
+}
+
+// DepartFrom closes the doors of the lift on the served requests. A hall call
+// that still has passengers waiting, left behind by a lift that filled up, goes
+// back to pending for another lift, and so do every hall call of a lift that
+// leaves full or under maintenance. It returns whether any request went back to pending.
+func DepartFrom(sessionID primitive.ObjectID, liftID primitive.ObjectID, served []*LiftRequest) (bool, error) {
+	waiting, err := db.GetPassengers(sessionID, PassengerWaiting)
+	if err != nil {
+		return false, err
+	}
+	leftBehind := func(liftRequest *LiftRequest) bool {
+		for _, passenger := range waiting {
+			if passenger.waitsOn(liftRequest) {
+				return true
+			}
+		}
+		return false
+	}
+
+	released := false
+	for _, liftRequest := range served {
+		if leftBehind(liftRequest) {
+			if err := db.ReleaseLiftRequest(liftRequest); err != nil && err != ErrLiftRequestNotActive {
+				return released, err
+			}
+			released = true
+			continue
+		}
+		if err := db.CompleteLiftRequest(liftRequest); err != nil && err != ErrLiftRequestNotActive {
+			return released, err
+		}
+	}
+
+	lift, err := GetLift(sessionID, liftID)
+	if err != nil {
+		return released, err
+	}
+	if lift.takesHallCalls() {
+		return released, nil
+	}
+	stops, err := db.GetLiftStops(liftID)
+	if err != nil {
+		return released, err
+	}
+	for _, stop := range stops {
+		if stop.Type != RequestHall {
+			continue
+		}
+		if err := db.ReleaseLiftRequest(stop); err != nil && err != ErrLiftRequestNotActive {
+			return released, err
+		}
+		released = true
+	}
+	return released, nil
+}
+
+// cancelWaitingPassengers sends home the passengers waiting on a cancelled
+// hall call.
+func cancelWaitingPassengers(liftRequest *LiftRequest) error {
+	if liftRequest.Type != RequestHall {
+		return nil
+	}
+	waiting, err := db.GetPassengers(liftRequest.Session, PassengerWaiting)
+	if err != nil {
+		return err
+	}
+	for _, passenger := range waiting {
+		if passenger.waitsOn(liftRequest) {
+			passenger.Status = PassengerCancelled
+			if err := db.UpdatePassenger(passenger); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StrandedLift is a lift a restart found claimed, it was moving, standing at a
+// stop or busy when the server went down.
+type StrandedLift struct {
+	Session primitive.ObjectID
+	Lift    *Lift
+}
+
+// AtStop tells whether the lift was standing at a stop with its doors open.
+func (stranded StrandedLift) AtStop() bool {
+	return stranded.Lift.Status == StatusDoorsOpen
+}
+
+// StrandedLifts lists the claimed lifts of every session, nothing is moving
+// them after a restart. Lifts saved as busy, from before lifts went through
+// their own states, are among them. Lifts whose session is gone are left out.
+func StrandedLifts() ([]StrandedLift, error) {
+	lifts, err := db.GetClaimedLifts()
+	if err != nil {
+		return nil, err
+	}
+
+	var stranded []StrandedLift
+	for _, lift := range lifts {
+		sessionID, err := db.GetLiftSession(lift.ID)
+		if err == ErrSessionNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stranded = append(stranded, StrandedLift{Session: sessionID, Lift: lift})
+	}
+	return stranded, nil
+}
+
+// StoppedAt returns the requests the stranded lift serves on the floor it stands
+// on with its doors open and how long its doors stay open yet, the rest of the
+// dwell since the lift was last saved. now is the virtual time of the session
+// the lift is picked up at.
+func StoppedAt(stranded StrandedLift, now time.Duration) ([]*LiftRequest, time.Duration, error) {
+	session, err := db.GetSession(stranded.Session)
+	if err != nil {
+		return nil, 0, err
+	}
+	lift := findLift(session, stranded.Lift.ID)
+	if lift == nil {
+		return nil, 0, ErrLiftNotFound
+	}
+
+	stops, err := db.GetLiftStops(lift.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !lift.takesHallCalls() {
+		stops = carStops(stops)
+	}
+	served, _ := serveAt(lift.CurrentFloor, lift.Direction, stops)
+
+	remaining := session.Kinematics.forLift(lift).DoorDuration() - (now - lift.SavedAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return served, remaining, nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoppedAtUsesVirtualTime(t *testing.T) {
+	store := NewMemoryStore()
+	UseStore(store)
+	session := newTestSession(t, store, 1)
+	lift := session.Lifts[0]
+	lift.CurrentFloor = 4
+	lift.Status = StatusDoorsOpen
+	lift.DoorState = DoorOpen
+	if err := UpdateLiftState(&lift, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stranded, err := StrandedLifts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stranded) != 1 || !stranded[0].AtStop() {
+		t.Fatalf("found %d stranded lifts, want the one at its stop", len(stranded))
+	}
+	dwell := session.Kinematics.forLift(&lift).DoorDuration()
+
+	for _, test := range []struct {
+		now  time.Duration
+		want time.Duration
+	}{
+		{10 * time.Second, dwell},
+		{10*time.Second + dwell/2, dwell - dwell/2},
+		{10*time.Second + dwell + time.Hour, 0},
+	} {
+		_, remaining, err := StoppedAt(stranded[0], test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining != test.want {
+			t.Errorf("at %v the doors stay open %v, want %v", test.now, remaining, test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store is the persistence layer behind the model functions. The mongo store is
+// used in production, the memory store for local development and tests.
+type Store interface {
+	// CreateSession stores the session document along with its lifts, the ids
+	// of both are filled in by the store.
+	CreateSession(sessionDoc SessionDocument, lifts []Lift) (*Session, error)
+	GetSession(sessionID primitive.ObjectID) (*Session, error)
+	// ListSessions returns limit sessions after skipping offset of them, newest
+	// first, along with the total number of sessions.
+	ListSessions(offset int, limit int) ([]*Session, int64, error)
+	// DeleteSession removes the session, its lifts, its lift requests and its
+	// passengers.
+	DeleteSession(sessionID primitive.ObjectID) error
+	TouchSession(sessionID primitive.ObjectID, at time.Time) error
+	// GetIdleSessions lists the sessions whose last activity is before since.
+	GetIdleSessions(since time.Time) ([]primitive.ObjectID, error)
+	// CreateLiftRequest stores the request, it fails with
+	// ErrDuplicateLiftRequest when the floor already has an active hall call in
+	// the same direction and with ErrDuplicateLiftStop when a car call's floor
+	// already is a stop of its lift.
+	CreateLiftRequest(liftRequest *LiftRequest) error
+	// AssignLiftRequest saves the lift and status of a pending request that was
+	// just dispatched, it fails with ErrLiftRequestNotActive when the request is
+	// no longer pending.
+	AssignLiftRequest(liftRequest *LiftRequest) error
+	// GetLiftRequests lists the requests with the given status, a nil session id
+	// lists the requests across every session.
+	GetLiftRequests(sessionID primitive.ObjectID, status string) ([]*LiftRequest, error)
+	// CountActiveLiftRequests is how many requests of the session are pending
+	// or queued.
+	CountActiveLiftRequests(sessionID primitive.ObjectID) (int, error)
+	// GetLiftStops lists the queued requests of the lift, oldest first.
+	GetLiftStops(liftID primitive.ObjectID) ([]*LiftRequest, error)
+	// ClaimLift moves the lift from idle to the given status, it fails with
+	// ErrLiftTaken when the lift is not idle.
+	ClaimLift(liftID primitive.ObjectID, status string) error
+	// FreeLift marks the lift idle with its doors closed and no heading, a lift
+	// under maintenance is marked out_of_service instead. It returns the lift
+	// as it was left.
+	FreeLift(liftID primitive.ObjectID) (*Lift, error)
+	// SetLiftMaintenance takes the lift out of rotation or puts it back. An
+	// idle lift taken out is marked out_of_service right away, one put back
+	// goes from out_of_service to idle.
+	SetLiftMaintenance(liftID primitive.ObjectID, maintenance bool) error
+	// UpdateLiftState saves the floor, status, direction, door state and
+	// virtual save time of a claimed lift.
+	UpdateLiftState(lift *Lift) error
+	// GetClaimedLifts lists the lifts across every session that are neither
+	// idle nor out of service.
+	GetClaimedLifts() ([]*Lift, error)
+	// GetLiftSession returns the id of the session the lift belongs to.
+	GetLiftSession(liftID primitive.ObjectID) (primitive.ObjectID, error)
+	// CompleteLiftRequest marks a queued request completed, the lift is left
+	// alone.
+	CompleteLiftRequest(liftRequest *LiftRequest) error
+	GetLiftRequest(requestID primitive.ObjectID) (*LiftRequest, error)
+	// CancelLiftRequest marks a queued or pending request cancelled, it fails
+	// with ErrLiftRequestNotActive when the request was completed or cancelled
+	// in the meantime. The lift is left alone.
+	CancelLiftRequest(liftRequest *LiftRequest) error
+	// ReleaseLiftRequest takes a queued request off its lift and makes it
+	// pending again, it fails with ErrLiftRequestNotActive when the request is
+	// no longer queued.
+	ReleaseLiftRequest(liftRequest *LiftRequest) error
+	// SetEmergency saves the emergency recall state of the session.
+	SetEmergency(sessionID primitive.ObjectID, emergency Emergency) error
+	// RecallLiftRequest marks a queued or pending request recalled, it fails
+	// with ErrLiftRequestNotActive when the request is no longer active.
+	RecallLiftRequest(liftRequest *LiftRequest) error
+	// RecordLiftHistory adds the entry to the history of every queued request
+	// of the lift.
+	RecordLiftHistory(liftID primitive.ObjectID, entry HistoryEntry) error
+	// UpdateLiftLoad saves the passengers and load of the lift.
+	UpdateLiftLoad(lift *Lift) error
+	CreatePassenger(passenger *Passenger) error
+	// GetPassengers lists the passengers of the session with the given status,
+	// every passenger of it when status is empty, oldest first.
+	GetPassengers(sessionID primitive.ObjectID, status string) ([]*Passenger, error)
+	// GetLiftPassengers lists the passengers riding the lift.
+	GetLiftPassengers(liftID primitive.ObjectID) ([]*Passenger, error)
+	// UpdatePassenger saves the status and lift of the passenger.
+	UpdatePassenger(passenger *Passenger) error
+}
+
+const (
+	DriverMongo  = "mongo"
+	DriverMemory = "memory"
+)
+
+var ErrSessionNotFound = utils.NotFound("Session Not Found")
+var ErrLiftRequestNotFound = utils.NotFound("Lift Request Not Found")
+var ErrLiftRequestNotActive = utils.Conflict("Lift request is no longer active")
+var ErrLiftTaken = utils.Conflict("Lift was taken by another request")
+var ErrDuplicateLiftRequest = utils.Conflict("Already a lift is called for the floor in that direction")
+var ErrDuplicateLiftStop = utils.Conflict("Floor is already a stop of the lift")
+var ErrLiftNotFound = utils.NotFound("Lift Not Found")
+var ErrLiftOutOfService = utils.Conflict("Lift is out of service")
+
+var db Store
+
+// UseStore replaces the active store, it is meant for tests and tools that
+// don't go through CreateDBInstance.
+func UseStore(store Store) {
+	db = store
+}
+
+func CreateDBInstance() {
+	driver := strings.ToLower(os.Getenv("DB_DRIVER"))
+
+	switch driver {
+	case DriverMemory:
+		db = NewMemoryStore()
+		fmt.Println("Using in-memory store")
+	case DriverMongo, "":
+		db = NewMongoStore()
+	default:
+		log.Fatalf("unknown DB_DRIVER %q, valid drivers are %s, %s", driver, DriverMongo, DriverMemory)
+	}
+}
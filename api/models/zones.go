@@ -0,0 +1,97 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/ivinayakg/go-lift-simulation/utils"
+)
+
+// Lifts of a zoned building serve a bank of floors, express lifts skip the
+// floors in between. A trip no single lift makes is split at a sky lobby, a
+// floor where the passenger changes from a lift of one bank to one of another.
+
+// FloorLabel is how the building calls the floor, the labels start from the
+// lowest floor.
+func (session *Session) FloorLabel(floor int) string {
+	index := floor - session.MinFloor
+	if index >= 0 && index < len(session.Building.FloorLabels) {
+		return session.Building.FloorLabels[index]
+	}
+	return strconv.Itoa(floor)
+}
+
+// servesFloor tells whether the lift stops on the floor.
+func (lift *Lift) servesFloor(floor int) bool {
+	if len(lift.ServedFloors) == 0 {
+		return true
+	}
+	for _, served := range lift.ServedFloors {
+		if served == floor {
+			return true
+		}
+	}
+	return false
+}
+
+// servesAny tells whether the lift stops on any of the floors, any lift does
+// when there are none.
+func (lift *Lift) servesAny(floors []int) bool {
+	if len(floors) == 0 {
+		return true
+	}
+	for _, floor := range floors {
+		if lift.servesFloor(floor) {
+			return true
+		}
+	}
+	return false
+}
+
+// connects tells whether a lift of the session stops on both floors.
+func (session *Session) connects(from int, to int) bool {
+	for i := range session.Lifts {
+		if session.Lifts[i].servesFloor(from) && session.Lifts[i].servesFloor(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFloorServed fails when no lift of the session stops on the floor.
+func (session *Session) checkFloorServed(floor int) error {
+	for i := range session.Lifts {
+		if session.Lifts[i].servesFloor(floor) {
+			return nil
+		}
+	}
+	return utils.InvalidArgument("No lift serves floor %v", session.FloorLabel(floor))
+}
+
+// planTransfer returns the sky lobby of a trip no single lift makes, the floor
+// on the way with the shortest detour, or nil when a lift goes straight there.
+func (session *Session) planTransfer(from int, to int) (*int, error) {
+	if err := session.checkFloorServed(from); err != nil {
+		return nil, err
+	}
+	if err := session.checkFloorServed(to); err != nil {
+		return nil, err
+	}
+	if session.connects(from, to) {
+		return nil, nil
+	}
+
+	var transfer *int
+	for floor := session.MinFloor; floor <= session.MaxFloor; floor++ {
+		if floor == from || floor == to || !session.connects(from, floor) || !session.connects(floor, to) {
+			continue
+		}
+		if transfer == nil || distance(from, floor)+distance(floor, to) < distance(from, *transfer)+distance(*transfer, to) {
+			lobby := floor
+			transfer = &lobby
+		}
+	}
+	if transfer == nil {
+		return nil, utils.InvalidArgument("No lift goes from floor %v to floor %v, not even with a transfer", session.FloorLabel(from), session.FloorLabel(to))
+	}
+	return transfer, nil
+}
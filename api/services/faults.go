@@ -0,0 +1,51 @@
+package services
+
+import (
+	"log"
+	"sync"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var injectors = make(map[primitive.ObjectID]*models.FaultInjector)
+var injectorsMu sync.Mutex
+
+// sessionFaults returns the fault injector of the session, its rolls carry on
+// from trip to trip so a seeded session fails the same way every run.
+func sessionFaults(sessionID primitive.ObjectID) *models.FaultInjector {
+	injectorsMu.Lock()
+	defer injectorsMu.Unlock()
+
+	injector, ok := injectors[sessionID]
+	if !ok {
+		session, err := models.GetSession(sessionID.Hex())
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		injector = models.NewFaultInjector(session.Faults)
+		injectors[sessionID] = injector
+	}
+	return injector
+}
+
+func forgetSessionFaults(sessionID primitive.ObjectID) {
+	injectorsMu.Lock()
+	defer injectorsMu.Unlock()
+	delete(injectors, sessionID)
+}
+
+// reportFault records the fault on the requests the lift is serving and tells
+// the session room.
+func reportFault(pool *Pool, sessionID primitive.ObjectID, liftID primitive.ObjectID, fault models.Fault) {
+	if err := models.RecordFault(liftID, fault); err != nil {
+		log.Println(err)
+	}
+	pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Fault"], "lift_id": liftID, "fault": fault.Kind, "floor": fault.Floor, "repair_duration": fault.Repair.Seconds()}})
+}
+
+func reportRepair(pool *Pool, sessionID primitive.ObjectID, liftID primitive.ObjectID, fault models.Fault) {
+	pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Repaired"], "lift_id": liftID, "fault": fault.Kind, "floor": fault.Floor}})
+}
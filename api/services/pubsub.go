@@ -1,94 +1,285 @@
 package services
 
 import (
-	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ivinayakg/go-lift-simulation/models"
+	"github.com/ivinayakg/go-lift-simulation/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type LiftRequestEvent struct {
 	ID             primitive.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
 	RequestedFloor int                `json:"requestedFloor"`
+	Direction      string             `json:"direction"`
+	Destination    *int               `json:"destination,omitempty"`
 	Lift           primitive.ObjectID `json:"lift"`
 	Status         string             `json:"status,omitempty"`
 	Session        primitive.ObjectID `json:"session"`
 	CreatedBy      primitive.ObjectID `json:"created_by"`
+	// Assigned is set when the request waited as pending before getting a lift.
+	Assigned bool `json:"assigned"`
+	// Claimed is set when the request took its lift off idle, the lift is
+	// set moving for it.
+	Claimed bool `json:"claimed"`
+}
+
+const (
+	DefaultSessionQueueLimit = 32
+	DefaultQueueRetryAfter   = 2 * time.Second
+)
+
+// queueFullMessage is what a client is told when the backlog of its session is
+// full.
+const queueFullMessage = "Too many requests for the session are waiting, try again later"
+
+// sessionQueue is the backlog of a session. admit lets one new request in at a
+// time, so the requests waiting for or riding a lift never go over the limit,
+// and requests holds the ones that claimed their lift and wait for the
+// processing loop to get it moving.
+//
+// Only the requests clients make go through admit. The car calls of boarding
+// passengers and the calls of passengers changing at a sky lobby come from
+// passengers that were admitted, one each, so they can't outgrow the limit.
+// requests needs no cap of its own, every request in it took its lift off idle
+// and a lift is claimed again only after the loop ran it, so it never holds
+// more requests than the session has lifts.
+type sessionQueue struct {
+	admit    sync.Mutex
+	mu       sync.Mutex
+	requests []*LiftRequestEvent
 }
 
 type PubSub struct {
-	Que         chan *LiftRequestEvent
-	Processing  bool
-	QueLength   int
-	QueCapacity int
+	mu     sync.Mutex
+	queues map[primitive.ObjectID]*sessionQueue
+	// freed holds the sessions a lift became idle in since the processing loop
+	// last looked, their pending requests are assigned from the loop. A session
+	// is in it once however often its lifts were freed.
+	freed map[primitive.ObjectID]bool
+	// wake is signalled when a request is queued or a lift freed, it never
+	// holds more than one signal so sending on it never blocks.
+	wake chan struct{}
+	// SessionLimit is how many active requests a session may have and
+	// RetryAfter how long a client turned away for it should wait.
+	SessionLimit int
+	RetryAfter   time.Duration
+	length       atomic.Int64
 }
 
-func NewPubSub() *PubSub {
-	activeRequests, err := models.GetLiftRequests("", models.StatusQueued)
+// NewPubSub opens the queue of every stored session and marks the sessions left
+// with pending requests freed, the lifts of the queued ones are picked up by
+// RecoverLifts.
+func NewPubSub(sessionLimit int, retryAfter time.Duration) *PubSub {
+	pubsub := &PubSub{
+		queues:       make(map[primitive.ObjectID]*sessionQueue),
+		freed:        make(map[primitive.ObjectID]bool),
+		wake:         make(chan struct{}, 1),
+		SessionLimit: sessionLimit,
+		RetryAfter:   retryAfter,
+	}
+
+	for page := 1; ; page++ {
+		sessions, err := models.ListSessions(page, models.MaxSessionsLimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, session := range sessions.Sessions {
+			pubsub.OpenQueue(session.ID)
+		}
+		if len(sessions.Sessions) < sessions.Limit {
+			break
+		}
+	}
+
+	pendingRequests, err := models.GetLiftRequests("", models.StatusPending)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, request := range pendingRequests {
+		pubsub.LiftFreed(request.Session)
+	}
+	return pubsub
+}
+
+// OpenQueue sets up the queue of a new session.
+func (pubsub *PubSub) OpenQueue(sessionID primitive.ObjectID) {
+	pubsub.mu.Lock()
+	defer pubsub.mu.Unlock()
+	if _, ok := pubsub.queues[sessionID]; !ok {
+		pubsub.queues[sessionID] = &sessionQueue{}
+	}
+}
 
-	queCapacity := 108
-	queChannel := make(chan *LiftRequestEvent, queCapacity)
-	queLength := len(activeRequests)
+// DropQueue forgets the queue of a session that is gone.
+func (pubsub *PubSub) DropQueue(sessionID primitive.ObjectID) {
+	pubsub.mu.Lock()
+	defer pubsub.mu.Unlock()
 
-	for _, request := range activeRequests {
-		fmt.Println(request)
-		request := &LiftRequestEvent{ID: request.ID, Lift: request.Lift, RequestedFloor: request.RequestedFloor, Status: request.Status, Session: request.Session, CreatedBy: primitive.NilObjectID}
-		queChannel <- request
+	if queue, ok := pubsub.queues[sessionID]; ok {
+		queue.mu.Lock()
+		pubsub.length.Add(-int64(len(queue.requests)))
+		queue.requests = nil
+		queue.mu.Unlock()
+		delete(pubsub.queues, sessionID)
 	}
+	delete(pubsub.freed, sessionID)
+}
+
+// queue returns the queue of the session, nil once it was dropped.
+func (pubsub *PubSub) queue(sessionID primitive.ObjectID) *sessionQueue {
+	pubsub.mu.Lock()
+	defer pubsub.mu.Unlock()
+	return pubsub.queues[sessionID]
+}
 
-	return &PubSub{
-		Que:         queChannel,
-		Processing:  false,
-		QueLength:   queLength,
-		QueCapacity: queCapacity,
+// Admit lets a new request into the session while its requests waiting for
+// or riding a lift are under the limit, it fails with a too many requests
+// error otherwise. The request has to be stored before done is called, the
+// next request of the session is held until then.
+func (pubsub *PubSub) Admit(sessionID primitive.ObjectID) (func(), error) {
+	queue := pubsub.queue(sessionID)
+	if queue == nil {
+		return nil, models.ErrSessionNotFound
 	}
+	queue.admit.Lock()
+	backlog, err := models.Backlog(sessionID)
+	if err != nil {
+		queue.admit.Unlock()
+		return nil, err
+	}
+	if backlog >= pubsub.SessionLimit {
+		queue.admit.Unlock()
+		return nil, utils.TooManyRequests(pubsub.RetryAfter, queueFullMessage)
+	}
+	return queue.admit.Unlock, nil
 }
 
+// AddToQue queues a request that claimed its lift for the processing loop, it
+// never blocks. The request is dropped when its session is gone.
 func (pubsub *PubSub) AddToQue(request *LiftRequestEvent) {
-	pubsub.Que <- request
-	pubsub.QueLength++
+	queue := pubsub.queue(request.Session)
+	if queue == nil {
+		return
+	}
+	queue.mu.Lock()
+	queue.requests = append(queue.requests, request)
+	pubsub.length.Add(1)
+	queue.mu.Unlock()
+	pubsub.signal()
+}
+
+// Length is how many requests wait for the processing loop across every
+// session.
+func (pubsub *PubSub) Length() int64 {
+	return pubsub.length.Load()
+}
+
+func (pubsub *PubSub) signal() {
+	select {
+	case pubsub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// LiftFreed tells the processing loop a lift of the session became idle, it
+// never blocks.
+func (pubsub *PubSub) LiftFreed(sessionID primitive.ObjectID) {
+	pubsub.mu.Lock()
+	pubsub.freed[sessionID] = true
+	pubsub.mu.Unlock()
+	pubsub.signal()
 }
 
-func (pubsub *PubSub) PopQue() *LiftRequestEvent {
-	if pubsub.QueLength > 0 {
-		request := <-pubsub.Que
-		pubsub.QueLength--
-		return request
+// popRequests takes the oldest queued request of every session, nil when
+// nothing is queued.
+func (pubsub *PubSub) popRequests() []*LiftRequestEvent {
+	pubsub.mu.Lock()
+	queues := make([]*sessionQueue, 0, len(pubsub.queues))
+	for _, queue := range pubsub.queues {
+		queues = append(queues, queue)
 	}
-	return nil
+	pubsub.mu.Unlock()
+
+	var requests []*LiftRequestEvent
+	for _, queue := range queues {
+		queue.mu.Lock()
+		if len(queue.requests) > 0 {
+			requests = append(requests, queue.requests[0])
+			queue.requests = queue.requests[1:]
+			pubsub.length.Add(-1)
+		}
+		queue.mu.Unlock()
+	}
+	return requests
 }
 
-func (pubsub *PubSub) Empty() bool {
-	return pubsub.QueLength == 0
+// takeFreed empties the set of freed sessions.
+func (pubsub *PubSub) takeFreed() []primitive.ObjectID {
+	pubsub.mu.Lock()
+	defer pubsub.mu.Unlock()
+
+	sessions := make([]primitive.ObjectID, 0, len(pubsub.freed))
+	for sessionID := range pubsub.freed {
+		sessions = append(sessions, sessionID)
+	}
+	pubsub.freed = make(map[primitive.ObjectID]bool)
+	return sessions
 }
 
+// ProcessRequests runs the queued requests and assigns the pending requests of
+// the sessions a lift was freed in. The sessions take turns so a busy one
+// doesn't hold the others up.
 func (pubsub *PubSub) ProcessRequests(cb func(*LiftRequestEvent)) {
-	// if pubsub.Processing {
-	// 	return
-	// }
-
-	// pubsub.Processing = true
-
-	for {
-		select {
-		case request := <-pubsub.Que:
-			// queLen := pubsub.Empty()
-			// if !queLen {
-			// 	pubsub.Processing = false
-			// 	break
-			// }
-			pubsub.QueLength--
-			cb(request)
+	for range pubsub.wake {
+		for {
+			requests := pubsub.popRequests()
+			freed := pubsub.takeFreed()
+			if len(requests) == 0 && len(freed) == 0 {
+				break
+			}
+			for _, request := range requests {
+				cb(request)
+			}
+			for _, sessionID := range freed {
+				assigned, err := models.AssignPendingLiftRequests(sessionID)
+				if err != nil {
+					log.Println(err)
+				}
+				for _, request := range assigned {
+					cb(&LiftRequestEvent{ID: request.ID, Lift: request.Lift, RequestedFloor: request.RequestedFloor, Direction: request.Direction, Destination: request.Destination, Status: request.Status, Session: request.Session, CreatedBy: primitive.NilObjectID, Assigned: true, Claimed: request.Claimed})
+				}
+			}
 		}
 	}
 }
 
 var Pubsubsys *PubSub
 
+// SetupPubSub reads the number of active requests a session may have from
+// SESSION_QUEUE_LIMIT and what clients turned away are told to wait from
+// QUEUE_RETRY_AFTER.
 func SetupPubSub() {
-	Pubsubsys = NewPubSub()
+	sessionLimit := DefaultSessionQueueLimit
+	if limit := os.Getenv("SESSION_QUEUE_LIMIT"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			log.Fatal("Invalid SESSION_QUEUE_LIMIT ", limit)
+		}
+		sessionLimit = parsed
+	}
+	retryAfter := DefaultQueueRetryAfter
+	if wait := os.Getenv("QUEUE_RETRY_AFTER"); wait != "" {
+		parsed, err := time.ParseDuration(wait)
+		if err != nil {
+			log.Fatal("Invalid QUEUE_RETRY_AFTER ", err)
+		}
+		retryAfter = parsed
+	}
+	Pubsubsys = NewPubSub(sessionLimit, retryAfter)
 }
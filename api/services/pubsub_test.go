@@ -0,0 +1,110 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestPubSub(t *testing.T, limit int) (*PubSub, *models.Session) {
+	t.Helper()
+	models.UseStore(models.NewMemoryStore())
+	session, err := models.CreateSession(models.SessionConfig{Floors: 40, Kinematics: models.DefaultKinematics(), Lifts: make([]models.LiftConfig, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubsub := NewPubSub(limit, 1500*time.Millisecond)
+	pubsub.OpenQueue(session.ID)
+	return pubsub, session
+}
+
+func TestLiftFreedNeverBlocks(t *testing.T) {
+	pubsub, _ := newTestPubSub(t, 5)
+
+	// Nothing reads from the pubsub, freeing lifts must not wait for it.
+	sessions := make([]primitive.ObjectID, 300)
+	for i := range sessions {
+		sessions[i] = primitive.NewObjectID()
+	}
+	for round := 0; round < 3; round++ {
+		for _, sessionID := range sessions {
+			pubsub.LiftFreed(sessionID)
+		}
+	}
+
+	if freed := pubsub.takeFreed(); len(freed) != len(sessions) {
+		t.Fatalf("%d sessions freed, want %d", len(freed), len(sessions))
+	}
+	if freed := pubsub.takeFreed(); len(freed) != 0 {
+		t.Fatalf("%d sessions freed twice", len(freed))
+	}
+}
+
+func TestAdmitLimitsTheBacklog(t *testing.T) {
+	pubsub, session := newTestPubSub(t, 5)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	admitted, turnedAway := 0, 0
+	for floor := 1; floor <= 30; floor++ {
+		wg.Add(1)
+		go func(floor int) {
+			defer wg.Done()
+			done, err := pubsub.Admit(session.ID)
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if utils.HTTPStatus(err) != 429 || utils.RetryAfter(err) != 1500*time.Millisecond {
+					t.Errorf("turned away with %v", err)
+				}
+				turnedAway++
+				return
+			}
+			_, _, err = models.CreateLiftRequest(floor, models.DirectionDown, nil, session.ID.Hex())
+			done()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				t.Errorf("creating the request got %v", err)
+			}
+			admitted++
+		}(floor)
+	}
+	wg.Wait()
+
+	if admitted != 5 || turnedAway != 25 {
+		t.Fatalf("%d admitted and %d turned away, want 5 and 25", admitted, turnedAway)
+	}
+	backlog, err := models.Backlog(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backlog != 5 {
+		t.Fatalf("backlog is %d, want 5", backlog)
+	}
+}
+
+func TestDroppedQueueStaysDropped(t *testing.T) {
+	pubsub, session := newTestPubSub(t, 5)
+	pubsub.AddToQue(&LiftRequestEvent{Session: session.ID})
+	pubsub.AddToQue(&LiftRequestEvent{Session: session.ID})
+	if pubsub.Length() != 2 {
+		t.Fatalf("length is %d, want 2", pubsub.Length())
+	}
+
+	pubsub.DropQueue(session.ID)
+	if _, err := pubsub.Admit(session.ID); err != models.ErrSessionNotFound {
+		t.Fatalf("admitting to a dropped session got %v, want ErrSessionNotFound", err)
+	}
+	pubsub.AddToQue(&LiftRequestEvent{Session: session.ID})
+	if pubsub.queue(session.ID) != nil {
+		t.Fatal("the dropped queue was created again")
+	}
+	if pubsub.Length() != 0 {
+		t.Fatalf("length is %d after the drop, want 0", pubsub.Length())
+	}
+}
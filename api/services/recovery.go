@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecoverLifts picks up where the lifts were when the server went down, the
+// trips they were on died with it. A lift standing at a stop closes its doors
+// once the rest of their dwell is over, a moving one goes on to its next stop
+// from the last floor it reached and one left without stops is freed. Idle
+// lifts with queued stops set off for them. The simulation stood still while
+// the server was down, a session picks up from the latest virtual time its
+// lifts were saved at.
+func RecoverLifts(pool *Pool) {
+	stranded, err := models.StrandedLifts()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	savedAt := make(map[primitive.ObjectID]time.Duration)
+	for _, liftAt := range stranded {
+		if liftAt.Lift.SavedAt > savedAt[liftAt.Session] {
+			savedAt[liftAt.Session] = liftAt.Lift.SavedAt
+		}
+	}
+	for sessionID, at := range savedAt {
+		SessionEngine(sessionID).StartFrom(at)
+	}
+
+	for _, liftAt := range stranded {
+		logStops(liftAt.Lift)
+		if liftAt.AtStop() {
+			resumeStop(pool, liftAt)
+			continue
+		}
+		runNextStop(pool, liftAt.Session, liftAt.Lift.ID, primitive.NilObjectID)
+	}
+
+	queued, err := models.GetLiftRequests("", models.StatusQueued)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	started := make(map[primitive.ObjectID]bool)
+	for _, request := range queued {
+		if started[request.Lift] || liftMoving(request.Lift) {
+			continue
+		}
+		started[request.Lift] = true
+		trip, err := models.PlanNextStop(request.Session, request.Lift)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if trip != nil && models.ClaimLift(request.Lift, trip.Status()) == nil {
+			fmt.Println("Starting idle lift", request.Lift.Hex(), "for its queued stops")
+			runNextStop(pool, request.Session, request.Lift, primitive.NilObjectID)
+		}
+	}
+}
+
+// resumeStop closes the doors of a lift a restart found standing at a stop, for
+// what is left of their dwell the lift holds on to its trip like one that just
+// arrived.
+func resumeStop(pool *Pool, liftAt models.StrandedLift) {
+	engine := SessionEngine(liftAt.Session)
+	served, remaining, err := models.StoppedAt(liftAt, engine.Now())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	fmt.Println("Lift", liftAt.Lift.ID.Hex(), "closes its doors on floor", liftAt.Lift.CurrentFloor, "in", remaining)
+
+	t := &runningTrip{session: liftAt.Session, target: liftAt.Lift.CurrentFloor, engine: engine, arrived: true}
+	tripsMu.Lock()
+	trips[liftAt.Lift.ID] = t
+	tripsMu.Unlock()
+
+	lift := &models.Lift{ID: liftAt.Lift.ID, CurrentFloor: liftAt.Lift.CurrentFloor, Status: models.StatusDoorsOpen, Direction: liftAt.Lift.Direction, DoorState: models.DoorOpen}
+	t.schedule(remaining, "doors_closed", func() {
+		closeDoors(pool, t, lift, served, primitive.NilObjectID)
+	})
+}
+
+// logStops reports the queued stops of a recovered lift and how long ago each
+// was made.
+func logStops(lift *models.Lift) {
+	stops, err := models.GetLiftStops(lift.ID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	fmt.Println("Recovering lift", lift.ID.Hex(), "found", lift.Status, "on floor", lift.CurrentFloor, "with", len(stops), "stops")
+	for _, stop := range stops {
+		age := "an unknown time"
+		if !stop.CreatedAt.IsZero() {
+			age = time.Since(stop.CreatedAt).Round(time.Second).String()
+		}
+		fmt.Println("  request", stop.ID.Hex(), "for floor", stop.RequestedFloor, "made", age, "ago")
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SessionDeletedByUser = "deleted"
+	SessionExpired       = "expired"
+)
+
+// DeleteSession stops the simulation of the session, disconnects its clients
+// and removes it with its lifts and requests.
+func DeleteSession(sessionID primitive.ObjectID, reason string) error {
+	if err := models.DeleteSession(sessionID); err != nil {
+		return err
+	}
+	stopSession(sessionID)
+	WSPool.CloseRoom <- &Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Session Deleted"], "reason": reason}}
+	return nil
+}
+
+// StartReaper deletes, every interval, the sessions nobody is connected to that
+// saw no activity for ttl.
+func StartReaper(ttl time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			reapIdleSessions(ttl)
+		}
+	}()
+}
+
+func reapIdleSessions(ttl time.Duration) {
+	sessionIDs, err := models.GetIdleSessions(time.Now().Add(-ttl))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, sessionID := range sessionIDs {
+		if WSPool.HasClients(sessionID) {
+			continue
+		}
+		if err := DeleteSession(sessionID, SessionExpired); err != nil {
+			log.Println(err)
+			continue
+		}
+		fmt.Printf("Reaped idle session %v\n", sessionID.Hex())
+	}
+}
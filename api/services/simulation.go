@@ -0,0 +1,530 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"github.com/ivinayakg/go-lift-simulation/simulation"
+	"github.com/ivinayakg/go-lift-simulation/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SimulationClock drives every session engine, tests swap it for a fake clock.
+var SimulationClock simulation.Clock = simulation.RealClock{}
+
+var engines = make(map[primitive.ObjectID]*simulation.Engine)
+var enginesMu sync.Mutex
+
+// SessionEngine returns the running engine of the session, lift movement of a
+// session is scheduled on it.
+func SessionEngine(sessionID primitive.ObjectID) *simulation.Engine {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	engine, ok := engines[sessionID]
+	if !ok {
+		engine = simulation.NewEngine(SimulationClock)
+		engine.Start()
+		engines[sessionID] = engine
+	}
+	return engine
+}
+
+// runningTrip holds the scheduled events of a lift going to its next stop so
+// the trip can be cut short or called off.
+type runningTrip struct {
+	mu      sync.Mutex
+	session primitive.ObjectID
+	target  int
+	engine  *simulation.Engine
+	events  []*simulation.Event
+	// arrived is set once the doors open, from then on the stop is served
+	// whatever happens to its requests.
+	arrived   bool
+	cancelled bool
+}
+
+// trips holds the trip every moving lift is on, by lift.
+var trips = make(map[primitive.ObjectID]*runningTrip)
+var tripsMu sync.Mutex
+
+// schedule adds an event to the trip, the callback is skipped once the trip is
+// cancelled. Callbacks run with the trip locked, they schedule more events with
+// scheduleLocked.
+func (t *runningTrip) schedule(delay time.Duration, name string, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scheduleLocked(delay, name, fn)
+}
+
+func (t *runningTrip) scheduleLocked(delay time.Duration, name string, fn func()) {
+	t.events = append(t.events, t.engine.Schedule(delay, name, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.cancelled {
+			fn()
+		}
+	}))
+}
+
+// dropEventsLocked cancels every event scheduled so far.
+func (t *runningTrip) dropEventsLocked() {
+	for _, event := range t.events {
+		t.engine.Cancel(event)
+	}
+	t.events = nil
+}
+
+func (t *runningTrip) cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cancelled = true
+	t.dropEventsLocked()
+}
+
+// stopTrip calls off the trip of the lift if it is still on its way to the
+// floor, it returns false when the lift is not heading there or already
+// stands there with its doors open.
+func stopTrip(liftID primitive.ObjectID, floor int) bool {
+	tripsMu.Lock()
+	t, ok := trips[liftID]
+	tripsMu.Unlock()
+	if !ok || t.target != floor {
+		return false
+	}
+	return t.callOff(liftID)
+}
+
+// haltTrip calls off the trip of the lift wherever it is heading, unless the
+// lift already stands at its stop with its doors open.
+func haltTrip(liftID primitive.ObjectID) bool {
+	tripsMu.Lock()
+	t, ok := trips[liftID]
+	tripsMu.Unlock()
+	if !ok {
+		return false
+	}
+	return t.callOff(liftID)
+}
+
+func (t *runningTrip) callOff(liftID primitive.ObjectID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.arrived || t.cancelled {
+		return false
+	}
+	t.cancelled = true
+	t.dropEventsLocked()
+
+	tripsMu.Lock()
+	if trips[liftID] == t {
+		delete(trips, liftID)
+	}
+	tripsMu.Unlock()
+	return true
+}
+
+func liftMoving(liftID primitive.ObjectID) bool {
+	tripsMu.Lock()
+	defer tripsMu.Unlock()
+	_, ok := trips[liftID]
+	return ok
+}
+
+// stopSession calls off every trip of the session and shuts its engine down.
+func stopSession(sessionID primitive.ObjectID) {
+	tripsMu.Lock()
+	var sessionTrips []*runningTrip
+	for liftID, t := range trips {
+		if t.session == sessionID {
+			sessionTrips = append(sessionTrips, t)
+			delete(trips, liftID)
+		}
+	}
+	tripsMu.Unlock()
+
+	for _, t := range sessionTrips {
+		t.cancel()
+	}
+
+	forgetSessionFaults(sessionID)
+	Pubsubsys.DropQueue(sessionID)
+
+	enginesMu.Lock()
+	engine, ok := engines[sessionID]
+	delete(engines, sessionID)
+	enginesMu.Unlock()
+	if ok {
+		engine.Stop()
+	}
+}
+
+// RunTrip gets the lift of a request moving once the request claimed it, the
+// lift then serves its stops until it runs out of them.
+func RunTrip(pool *Pool, lr *LiftRequestEvent) {
+	if lr.Assigned && lr.Status == models.StatusQueued {
+		pool.Publish(&Message{SessionID: lr.Session, Body: bson.M{"event": SocketEvents["Request Assigned"], "request_id": lr.ID, "floor_requested": lr.RequestedFloor, "direction": lr.Direction, "destination": lr.Destination, "lift_id": lr.Lift}})
+	}
+	if !lr.Claimed || liftMoving(lr.Lift) {
+		return
+	}
+	runNextStop(pool, lr.Session, lr.Lift, lr.CreatedBy)
+}
+
+// runNextStop sends the claimed lift to its next stop, with none left the lift
+// is freed for the pending requests of the session.
+func runNextStop(pool *Pool, sessionID primitive.ObjectID, liftID primitive.ObjectID, createdBy primitive.ObjectID) {
+	for {
+		trip, err := models.PlanNextStop(sessionID, liftID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if trip != nil {
+			runLiftTrip(pool, sessionID, trip, createdBy)
+			return
+		}
+
+		lift, err := models.FreeLift(liftID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Position"], "lift_id": liftID, "floor": lift.CurrentFloor, "status": lift.Status, "direction": lift.Direction, "door_state": lift.DoorState}})
+
+		// A stop added while the lift was being freed could not claim it, the
+		// lift is claimed back for it unless someone else got it first.
+		trip, err = models.PlanNextStop(sessionID, liftID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if trip == nil || models.ClaimLift(liftID, trip.Status()) != nil {
+			Pubsubsys.LiftFreed(sessionID)
+			return
+		}
+	}
+}
+
+// runLiftTrip schedules the trip of the lift on the session engine. Every floor
+// the lift passes is reported to the session room and, when a stop was added
+// there since the lift set off, the lift stops on it. At the stop the lift
+// opens its doors for the requests it serves there and moves on to its next
+// stop once they close. The faults rolled for the trip hold it up on the way.
+func runLiftTrip(pool *Pool, sessionID primitive.ObjectID, trip *models.Trip, createdBy primitive.ObjectID) {
+	sessionFaults(sessionID).Inject(trip)
+	pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Moved"], "floor_requested": trip.ToFloor, "lift_id": trip.Lift, "from_floor": trip.FromFloor, "direction": trip.Heading, "travel_duration": trip.Travel.Seconds(), "door_duration": trip.Door.Seconds()}, CreatedBy: createdBy})
+
+	t := &runningTrip{session: sessionID, target: trip.ToFloor, engine: SessionEngine(sessionID)}
+	tripsMu.Lock()
+	trips[trip.Lift] = t
+	tripsMu.Unlock()
+
+	lift := &models.Lift{ID: trip.Lift, CurrentFloor: trip.FromFloor, Status: trip.Status(), Direction: trip.Heading, DoorState: models.DoorClosed}
+	saveLift := func() {
+		saveLiftState(pool, sessionID, lift)
+	}
+
+	// arrive opens the doors on the floor the lift reached, the trip is locked.
+	arrive := func() {
+		t.arrived = true
+		t.target = lift.CurrentFloor
+		if trip.DoorJam > 0 {
+			reportFault(pool, sessionID, lift.ID, models.Fault{Kind: models.FaultDoorJam, Floor: lift.CurrentFloor, Repair: trip.DoorJam})
+		}
+		arrival, err := models.ArriveAt(sessionID, lift.ID, lift.CurrentFloor, lift.Direction)
+		if err != nil {
+			log.Println(err)
+			arrival = &models.Arrival{Heading: lift.Direction}
+		}
+		served, heading := arrival.Served, arrival.Heading
+
+		turned := heading != lift.Direction
+		lift.Status = models.StatusDoorsOpen
+		lift.Direction = heading
+		lift.DoorState = models.DoorOpen
+		saveLift()
+		for _, passenger := range arrival.Alighted {
+			pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Passenger Alighted"], "passenger_id": passenger.ID, "lift_id": lift.ID, "floor": lift.CurrentFloor, "passengers": arrival.Lift.Passengers, "load": arrival.Lift.Load}})
+		}
+		for _, liftRequest := range served {
+			pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Arrived"], "request_id": liftRequest.ID, "type": liftRequest.Type, "lift_id": lift.ID, "floor": lift.CurrentFloor, "direction": heading}})
+			if liftRequest.Destination != nil {
+				board(pool, sessionID, lift.ID, *liftRequest.Destination)
+			}
+		}
+		for _, passenger := range arrival.Boarded {
+			pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Passenger Boarded"], "passenger_id": passenger.ID, "lift_id": lift.ID, "floor": lift.CurrentFloor, "destination": passenger.To(), "passengers": arrival.Lift.Passengers, "load": arrival.Lift.Load}})
+			board(pool, sessionID, lift.ID, passenger.To())
+		}
+		for _, passenger := range arrival.Transferred {
+			pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Passenger Transferred"], "passenger_id": passenger.ID, "lift_id": lift.ID, "floor": lift.CurrentFloor, "destination": passenger.Destination}})
+			transfer(sessionID, passenger, createdBy)
+		}
+		if turned || len(arrival.Alighted) > 0 {
+			// Pending calls ahead of the lift the new way, or waiting for room
+			// in it, can ride along now.
+			Pubsubsys.LiftFreed(sessionID)
+		}
+
+		t.scheduleLocked(trip.Door, "doors_closed", func() {
+			if trip.DoorJam > 0 {
+				reportRepair(pool, sessionID, lift.ID, models.Fault{Kind: models.FaultDoorJam, Floor: lift.CurrentFloor})
+			}
+			closeDoors(pool, t, lift, served, createdBy)
+		})
+	}
+
+	saveLift()
+	for _, fault := range trip.Faults {
+		fault := fault
+		t.schedule(fault.At, "lift_fault", func() {
+			reportFault(pool, sessionID, lift.ID, fault)
+		})
+		t.schedule(fault.At+fault.Repair, "lift_repaired", func() {
+			reportRepair(pool, sessionID, lift.ID, fault)
+		})
+	}
+	if trip.ToFloor == trip.FromFloor {
+		t.schedule(trip.Departure, "doors_open", arrive)
+		return
+	}
+
+	step := 1
+	if trip.Direction() == models.DirectionDown {
+		step = -1
+	}
+	for _, offset := range trip.FloorOffsets {
+		t.schedule(trip.Departure+offset, "lift_position", func() {
+			lift.CurrentFloor += step
+			saveLift()
+			if lift.CurrentFloor == trip.ToFloor {
+				arrive()
+				return
+			}
+			stop, err := models.ShouldStopAt(sessionID, lift.ID, lift.CurrentFloor, lift.Direction)
+			if err != nil {
+				log.Println(err)
+			}
+			if stop {
+				// Picked up on the way, the rest of the trip is planned again
+				// once the doors close.
+				t.dropEventsLocked()
+				arrive()
+			}
+		})
+	}
+}
+
+// saveLiftState saves the state of the claimed lift, as of the virtual time of
+// its session, and reports it to the session room.
+func saveLiftState(pool *Pool, sessionID primitive.ObjectID, lift *models.Lift) {
+	if err := models.UpdateLiftState(lift, SessionEngine(sessionID).Now()); err != nil {
+		log.Println(err)
+	}
+	pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Position"], "lift_id": lift.ID, "floor": lift.CurrentFloor, "status": lift.Status, "direction": lift.Direction, "door_state": lift.DoorState}})
+}
+
+// closeDoors ends the stop of the trip once the doors close, the served
+// requests are done and the lift moves on to its next stop. The trip is locked.
+func closeDoors(pool *Pool, t *runningTrip, lift *models.Lift, served []*models.LiftRequest, createdBy primitive.ObjectID) {
+	tripsMu.Lock()
+	if trips[lift.ID] == t {
+		delete(trips, lift.ID)
+	}
+	tripsMu.Unlock()
+
+	released, err := models.DepartFrom(t.session, lift.ID, served)
+	if err != nil {
+		log.Println(err)
+	}
+	lift.DoorState = models.DoorClosed
+	saveLiftState(pool, t.session, lift)
+	runNextStop(pool, t.session, lift.ID, createdBy)
+	if released {
+		// Passengers the lift had no room for wait for another one.
+		Pubsubsys.LiftFreed(t.session)
+	}
+}
+
+// board adds the destination a passenger keyed in at the hall to the lift they
+// got on, as if they pressed its button inside.
+func board(pool *Pool, sessionID primitive.ObjectID, liftID primitive.ObjectID, floor int) {
+	liftRequest, err := models.AddDestination(sessionID, liftID, floor)
+	if err == models.ErrDuplicateLiftStop {
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	pool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Stop Added"], "request_id": liftRequest.ID, "floor": liftRequest.RequestedFloor, "lift_id": liftID}})
+}
+
+// transfer calls a lift for the second leg of a passenger that got off at a sky
+// lobby, a claimed call is queued like one made at the hall.
+func transfer(sessionID primitive.ObjectID, passenger *models.Passenger, createdBy primitive.ObjectID) {
+	liftRequest, err := models.CallLift(sessionID, passenger)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if liftRequest.Claimed {
+		Pubsubsys.AddToQue(&LiftRequestEvent{ID: liftRequest.ID, RequestedFloor: liftRequest.RequestedFloor, Direction: liftRequest.Direction, Destination: liftRequest.Destination, Lift: liftRequest.Lift, Status: liftRequest.Status, Session: liftRequest.Session, CreatedBy: createdBy, Claimed: true})
+	}
+}
+
+// CancelLiftRequest withdraws the request. When it was the last reason for its
+// lift to head to the floor the trip is called off, the lift stops on the last
+// floor it reached and moves on to its next stop.
+func CancelLiftRequest(sessionID primitive.ObjectID, requestID primitive.ObjectID, createdBy primitive.ObjectID) (*models.LiftRequest, error) {
+	liftRequest, err := models.GetLiftRequest(sessionID, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.CancelLiftRequest(liftRequest); err != nil {
+		return nil, err
+	}
+	liftRequest.Status = models.StatusCancelled
+
+	WSPool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Request Cancelled"], "request_id": liftRequest.ID, "floor_requested": liftRequest.RequestedFloor, "direction": liftRequest.Direction, "lift_id": liftRequest.Lift}, CreatedBy: createdBy})
+	if liftRequest.Lift != primitive.NilObjectID && stopTrip(liftRequest.Lift, liftRequest.RequestedFloor) {
+		runNextStop(WSPool, sessionID, liftRequest.Lift, createdBy)
+	}
+	return liftRequest, nil
+}
+
+// AddDestination adds a car call to the lift and broadcasts it to the session
+// room, an idle lift sets off for it right away.
+func AddDestination(sessionID primitive.ObjectID, liftID primitive.ObjectID, floor int, createdBy primitive.ObjectID) (*models.LiftRequest, error) {
+	done, err := Pubsubsys.Admit(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	liftRequest, err := models.AddDestination(sessionID, liftID, floor)
+	done()
+	if err != nil {
+		return nil, err
+	}
+
+	WSPool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Stop Added"], "request_id": liftRequest.ID, "floor": liftRequest.RequestedFloor, "lift_id": liftID}, CreatedBy: createdBy})
+	if liftRequest.Claimed {
+		runNextStop(WSPool, sessionID, liftID, createdBy)
+	}
+	return liftRequest, nil
+}
+
+// SetLiftMaintenance takes the lift out of service or puts it back and tells
+// the session room. A lift on its way to one of the hall calls it gave up turns
+// to its riders' stops, the other lifts are woken up for the released calls.
+func SetLiftMaintenance(sessionID primitive.ObjectID, liftID primitive.ObjectID, outOfService bool, createdBy primitive.ObjectID) (*models.Lift, error) {
+	lift, released, err := models.SetLiftMaintenance(sessionID, liftID, outOfService)
+	if err != nil {
+		return nil, err
+	}
+
+	WSPool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Lift Maintenance"], "lift_id": liftID, "maintenance": lift.Maintenance, "status": lift.Status, "floor": lift.CurrentFloor}, CreatedBy: createdBy})
+	stopped := false
+	for _, liftRequest := range released {
+		if stopTrip(liftID, liftRequest.RequestedFloor) {
+			stopped = true
+		}
+	}
+	if stopped {
+		runNextStop(WSPool, sessionID, liftID, createdBy)
+	}
+	if len(released) > 0 || !outOfService {
+		Pubsubsys.LiftFreed(sessionID)
+	}
+	return lift, nil
+}
+
+// SetEmergency starts or clears the fire service recall of the session and
+// tells the session room. On start every lift in service heads to the
+// evacuation floor, a moving lift turns there from the last floor it passed
+// and one with its doors open once they close.
+func SetEmergency(sessionID primitive.ObjectID, active bool, floor *int, createdBy primitive.ObjectID) (*models.Emergency, error) {
+	emergency, recalled, err := models.SetEmergency(sessionID, active, floor)
+	if err != nil {
+		return nil, err
+	}
+
+	recalledIDs := make([]primitive.ObjectID, 0, len(recalled))
+	for _, liftRequest := range recalled {
+		recalledIDs = append(recalledIDs, liftRequest.ID)
+	}
+	WSPool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Emergency Changed"], "active": emergency.Active, "floor": emergency.Floor, "recalled_requests": recalledIDs}, CreatedBy: createdBy})
+	if !active {
+		return emergency, nil
+	}
+
+	session, err := models.GetSession(sessionID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	for _, lift := range session.Lifts {
+		if haltTrip(lift.ID) {
+			runNextStop(WSPool, sessionID, lift.ID, createdBy)
+			continue
+		}
+		if lift.Status != models.StatusIdle {
+			continue
+		}
+		trip, err := models.PlanNextStop(sessionID, lift.ID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if trip != nil && models.ClaimLift(lift.ID, trip.Status()) == nil {
+			runNextStop(WSPool, sessionID, lift.ID, createdBy)
+		}
+	}
+	return emergency, nil
+}
+
+const (
+	SpeedPause  = "pause"
+	SpeedResume = "resume"
+	MaxSpeed    = 100
+)
+
+type SessionSpeed struct {
+	Session    primitive.ObjectID `json:"session"`
+	Multiplier float64            `json:"multiplier"`
+	Paused     bool               `json:"paused"`
+}
+
+// SetSessionSpeed pauses or resumes the session with the pause and resume
+// actions, a multiplier above 0 changes how fast its time runs. The change is
+// broadcast to the session room.
+func SetSessionSpeed(sessionID primitive.ObjectID, action string, multiplier float64, createdBy primitive.ObjectID) (*SessionSpeed, error) {
+	if multiplier < 0 || multiplier > MaxSpeed {
+		return nil, utils.InvalidArgument("multiplier should be between 0 and %v", MaxSpeed)
+	}
+
+	engine := SessionEngine(sessionID)
+	switch action {
+	case SpeedPause:
+		engine.Pause()
+	case SpeedResume:
+		engine.Resume()
+	case "":
+		if multiplier == 0 {
+			return nil, utils.InvalidArgument("either an action or a multiplier is required")
+		}
+	default:
+		return nil, utils.InvalidArgument("invalid action, valid actions are pause, resume")
+	}
+	if multiplier > 0 {
+		engine.SetSpeed(multiplier)
+	}
+
+	speed, paused := engine.Speed()
+	sessionSpeed := &SessionSpeed{Session: sessionID, Multiplier: speed, Paused: paused}
+	WSPool.Publish(&Message{SessionID: sessionID, Body: bson.M{"event": SocketEvents["Speed Changed"], "multiplier": speed, "paused": paused}, CreatedBy: createdBy})
+	return sessionSpeed, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/go-lift-simulation/models"
+	"github.com/ivinayakg/go-lift-simulation/simulation"
+)
+
+const testStep = 100 * time.Millisecond
+
+// runHallCall plays a session with one lift answering a hall call on the
+// fifth floor against a fake clock. The engine of the session is driven by
+// hand, so the run doesn't depend on goroutine scheduling. It returns the
+// events the session room was sent, each with the virtual time it went out by.
+func runHallCall(t *testing.T) ([]string, *models.LiftRequest) {
+	t.Helper()
+	models.UseStore(models.NewMemoryStore())
+	clock := simulation.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	SimulationClock = clock
+	t.Cleanup(func() { SimulationClock = simulation.RealClock{} })
+
+	session, err := models.CreateSession(models.SessionConfig{Floors: 10, Kinematics: models.DefaultKinematics(), Lifts: make([]models.LiftConfig, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Pubsubsys = NewPubSub(DefaultSessionQueueLimit, DefaultQueueRetryAfter)
+	engine := simulation.NewEngine(clock)
+	enginesMu.Lock()
+	engines[session.ID] = engine
+	enginesMu.Unlock()
+	t.Cleanup(func() { stopSession(session.ID) })
+
+	liftRequest, _, err := models.CreateLiftRequest(5, models.DirectionDown, nil, session.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !liftRequest.Claimed {
+		t.Fatal("the idle lift wasn't claimed for the hall call")
+	}
+
+	pool := NewPool()
+	RunTrip(pool, &LiftRequestEvent{ID: liftRequest.ID, RequestedFloor: liftRequest.RequestedFloor, Direction: liftRequest.Direction, Lift: liftRequest.Lift, Status: liftRequest.Status, Session: session.ID, Claimed: true})
+
+	var events []string
+	drain := func() {
+		for {
+			select {
+			case message := <-pool.Broadcast:
+				body := message.Body
+				events = append(events, fmt.Sprintf("%v %v floor=%v status=%v doors=%v", engine.Now(), body["event"], body["floor"], body["status"], body["door_state"]))
+			default:
+				return
+			}
+		}
+	}
+	drain()
+	for i := 0; i < 600 && liftMoving(liftRequest.Lift); i++ {
+		clock.Advance(testStep)
+		engine.RunDue()
+		drain()
+	}
+	if liftMoving(liftRequest.Lift) {
+		t.Fatal("the lift is still on its trip after a minute")
+	}
+
+	stored, err := models.GetLiftRequest(session.ID, liftRequest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events, stored
+}
+
+func TestSessionRunsOnFakeClock(t *testing.T) {
+	events, liftRequest := runHallCall(t)
+
+	if liftRequest.Status != models.StatusCompleted {
+		t.Fatalf("request is %v, want %v", liftRequest.Status, models.StatusCompleted)
+	}
+	lift, err := models.GetLift(liftRequest.Session, liftRequest.Lift)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lift.Status != models.StatusIdle || lift.CurrentFloor != 5 || lift.DoorState != models.DoorClosed {
+		t.Fatalf("lift ended %v on floor %d with doors %v, want idle on 5 closed", lift.Status, lift.CurrentFloor, lift.DoorState)
+	}
+
+	// The lift passes every floor on the way up, opens on the fifth, closes and
+	// is freed.
+	var floors []string
+	for _, event := range events {
+		if strings.Contains(event, " "+SocketEvents["Lift Position"]+" ") {
+			floors = append(floors, event[strings.Index(event, "floor="):])
+		}
+	}
+	want := []string{
+		"floor=0 status=moving_up doors=closed",
+		"floor=1 status=moving_up doors=closed",
+		"floor=2 status=moving_up doors=closed",
+		"floor=3 status=moving_up doors=closed",
+		"floor=4 status=moving_up doors=closed",
+		"floor=5 status=moving_up doors=closed",
+		"floor=5 status=doors_open doors=open",
+		"floor=5 status=doors_open doors=closed",
+		"floor=5 status=idle doors=closed",
+	}
+	if !reflect.DeepEqual(floors, want) {
+		t.Fatalf("lift went\n%v\nwant\n%v\nevents\n%v", floors, want, events)
+	}
+}
+
+func TestSessionRunIsRepeatable(t *testing.T) {
+	first, _ := runHallCall(t)
+	second, _ := runHallCall(t)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("two runs differ\n%v\n%v", first, second)
+	}
+}
@@ -1,9 +1,12 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -16,8 +19,35 @@ import (
 var SocketEvents = map[string]string{
 	"User Joined": "user_joined",
 	"Lift Moved":  "lift_moved",
-	"User Left":   "user_left",
-	"Client Info": "client_info",
+	// Lift Position is sent for every floor a lift passes and when its doors move.
+	"Lift Position": "lift_position",
+	"User Left":     "user_left",
+	"Client Info":   "client_info",
+	// Request Assigned is sent when a pending request finally gets a lift.
+	"Request Assigned":  "request_assigned",
+	"Speed Changed":     "speed_changed",
+	"Request Cancelled": "request_cancelled",
+	"Session Deleted":   "session_deleted",
+	"Error":             "error",
+	// Stop Added is sent for every car call, Lift Arrived when a lift opens its
+	// doors at one of its stops.
+	"Stop Added":   "stop_added",
+	"Lift Arrived": "lift_arrived",
+	// Passenger Boarded and Passenger Alighted carry the passengers and load of
+	// the lift once everyone at the stop got on and off.
+	"Passenger Boarded":  "passenger_boarded",
+	"Passenger Alighted": "passenger_alighted",
+	// Passenger Transferred is sent when a passenger gets off at a sky lobby to
+	// change lifts.
+	"Passenger Transferred": "passenger_transferred",
+	// Lift Maintenance is sent when a lift is taken out of service or put back.
+	"Lift Maintenance": "lift_maintenance",
+	// Lift Fault is sent when a lift breaks down, gets stuck between floors or
+	// its doors jam, Lift Repaired once it works again.
+	"Lift Fault":    "lift_fault",
+	"Lift Repaired": "lift_repaired",
+	// Emergency Changed is sent when a fire service recall starts or is cleared.
+	"Emergency Changed": "emergency_changed",
 }
 
 var upgrader = websocket.Upgrader{
@@ -57,6 +87,18 @@ type Message struct {
 	Body      bson.M             `json:"body"`
 	SessionID primitive.ObjectID `json:"session_id"`
 	CreatedBy primitive.ObjectID `json:"created_by"`
+	// Recipient limits the message to a single client of the session.
+	Recipient primitive.ObjectID `json:"-"`
+}
+
+// Command is what clients send over the socket to control their session.
+type Command struct {
+	Command    string  `json:"command"`
+	Action     string  `json:"action"`
+	Multiplier float64 `json:"multiplier"`
+	// LiftID and Floor are the lift and stop of the destination command.
+	LiftID string `json:"lift_id"`
+	Floor  int    `json:"floor"`
 }
 
 type SessionRoom struct {
@@ -64,11 +106,26 @@ type SessionRoom struct {
 	Clients   map[primitive.ObjectID]*Client
 }
 
+// broadcastCapacity is how many messages wait for the pool before Publish
+// drops them.
+const broadcastCapacity = 1024
+
+// writeWait is how long a write to a client may take before the client is
+// dropped.
+const writeWait = 5 * time.Second
+
 type Pool struct {
 	Register   chan *Client
 	Unregister chan *Client
-	Sessions   map[primitive.ObjectID]*SessionRoom
-	Broadcast  chan *Message
+	// mu guards Sessions and the clients of every room.
+	mu       sync.RWMutex
+	Sessions map[primitive.ObjectID]*SessionRoom
+	// Broadcast is buffered, events are sent on it with Publish so a slow pool
+	// never holds up the simulation.
+	Broadcast chan *Message
+	// CloseRoom disconnects every client of the session after sending them the
+	// message.
+	CloseRoom chan *Message
 }
 
 func NewPool() *Pool {
@@ -76,7 +133,49 @@ func NewPool() *Pool {
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Sessions:   make(map[primitive.ObjectID]*SessionRoom),
-		Broadcast:  make(chan *Message),
+		Broadcast:  make(chan *Message, broadcastCapacity),
+		CloseRoom:  make(chan *Message),
+	}
+}
+
+// HasClients tells if anyone is connected to the session.
+func (pool *Pool) HasClients(sessionID primitive.ObjectID) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	session := pool.Sessions[sessionID]
+	return session != nil && len(session.Clients) > 0
+}
+
+// Publish hands the message to the pool without waiting, the message is dropped
+// when the pool is too far behind. Lift events are published from simulation
+// callbacks, they must never block.
+func (pool *Pool) Publish(message *Message) {
+	select {
+	case pool.Broadcast <- message:
+	default:
+		log.Println("Broadcast queue is full, dropping message for session", message.SessionID.Hex())
+	}
+}
+
+// send writes the message to the client, giving up after writeWait.
+func (c *Client) send(message interface{}) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteJSON(message)
+}
+
+// dropClients disconnects the clients a write failed for, their read loops
+// then unregister them.
+func (pool *Pool) dropClients(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+	pool.mu.Lock()
+	for _, client := range clients {
+		delete(client.SessionRoom.Clients, client.ID)
+	}
+	pool.mu.Unlock()
+	for _, client := range clients {
+		client.Conn.Close()
 	}
 }
 
@@ -84,23 +183,40 @@ func (pool *Pool) Start() {
 	for {
 		select {
 		case client := <-pool.Register:
-			clients := pool.Sessions[client.SessionRoom.SessionID].Clients
-			client.Conn.WriteJSON(Message{Body: bson.M{"event": SocketEvents["Client Info"], "clientId": client.ID}, SessionID: client.SessionRoom.SessionID})
+			pool.mu.RLock()
+			clients := client.SessionRoom.Clients
+			client.send(Message{Body: bson.M{"event": SocketEvents["Client Info"], "clientId": client.ID}, SessionID: client.SessionRoom.SessionID})
 			fmt.Printf("\nSize of Connection Pool: %d, for the session ID %v\n", len(clients), client.SessionRoom.SessionID)
 			for _, client := range clients {
-				client.Conn.WriteJSON(Message{Body: bson.M{"event": SocketEvents["User Joined"]}, SessionID: client.SessionRoom.SessionID})
+				client.send(Message{Body: bson.M{"event": SocketEvents["User Joined"]}, SessionID: client.SessionRoom.SessionID})
 			}
+			pool.mu.RUnlock()
 		case client := <-pool.Unregister:
-			clients := pool.Sessions[client.SessionRoom.SessionID].Clients
+			pool.mu.Lock()
+			clients := client.SessionRoom.Clients
 			for _, client := range clients {
-				client.Conn.WriteJSON(Message{Body: bson.M{"event": SocketEvents["User Left"]}, SessionID: client.SessionRoom.SessionID})
+				client.send(Message{Body: bson.M{"event": SocketEvents["User Left"]}, SessionID: client.SessionRoom.SessionID})
 			}
 			delete(clients, client.ID)
-			if len(clients) == 0 {
+			if len(clients) == 0 && pool.Sessions[client.SessionRoom.SessionID] == client.SessionRoom {
 				delete(pool.Sessions, client.SessionRoom.SessionID)
 			}
+			pool.mu.Unlock()
 			fmt.Printf("\nSize of Connection Pool: %d, for the session ID %v\n", len(clients), client.SessionRoom.SessionID)
+		case message := <-pool.CloseRoom:
+			pool.mu.Lock()
+			if session := pool.Sessions[message.SessionID]; session != nil {
+				for _, client := range session.Clients {
+					client.send(message)
+					client.Conn.Close()
+				}
+				session.Clients = make(map[primitive.ObjectID]*Client)
+				delete(pool.Sessions, message.SessionID)
+			}
+			pool.mu.Unlock()
 		case message := <-pool.Broadcast:
+			var failed []*Client
+			pool.mu.RLock()
 			if session := pool.Sessions[message.SessionID]; session != nil {
 				clients := session.Clients
 				fmt.Printf("\nSending message to all clients in session %v\n, message is %v", message.SessionID, message)
@@ -108,12 +224,17 @@ func (pool *Pool) Start() {
 					if client.ID == message.CreatedBy {
 						continue
 					}
-					if err := client.Conn.WriteJSON(message); err != nil {
+					if message.Recipient != primitive.NilObjectID && client.ID != message.Recipient {
+						continue
+					}
+					if err := client.send(message); err != nil {
 						fmt.Println(err)
-						return
+						failed = append(failed, client)
 					}
 				}
 			}
+			pool.mu.RUnlock()
+			pool.dropClients(failed)
 		}
 	}
 }
@@ -122,30 +243,70 @@ func (c *Client) Read() {
 	defer func() {
 		c.Pool.Unregister <- c
 		c.Conn.Close()
+		models.TouchSession(c.SessionRoom.SessionID)
 	}()
 
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			log.Println(err)
 			return
 		}
+
+		var command Command
+		if err := json.Unmarshal(data, &command); err != nil || command.Command == "" {
+			continue
+		}
+		if err := c.handleCommand(&command); err != nil {
+			body := ErrorEvent(err)
+			body["command"] = command.Command
+			c.Pool.Publish(&Message{SessionID: c.SessionRoom.SessionID, Recipient: c.ID, Body: body})
+		}
+	}
+}
+
+// ErrorEvent is the body of the error event sent to a client whose command
+// failed, it carries the same kinds the HTTP API maps to status codes.
+func ErrorEvent(err error) bson.M {
+	if utils.KindOf(err) == utils.KindInternal {
+		log.Println(err)
+	}
+	return bson.M{"event": SocketEvents["Error"], "kind": utils.KindOf(err), "error": utils.PublicMessage(err)}
+}
+
+func (c *Client) handleCommand(command *Command) error {
+	switch command.Command {
+	case "speed":
+		_, err := SetSessionSpeed(c.SessionRoom.SessionID, command.Action, command.Multiplier, c.ID)
+		return err
+	case "destination":
+		liftID, err := models.ParseID(command.LiftID, "lift")
+		if err != nil {
+			return err
+		}
+		_, err = AddDestination(c.SessionRoom.SessionID, liftID, command.Floor, c.ID)
+		return err
+	default:
+		return utils.InvalidArgument("unknown command %v", command.Command)
 	}
 }
 
 func serveWS(pool *Pool, w http.ResponseWriter, r *http.Request) error {
 	fmt.Println("WebSocket endpoint reached")
 
-	conn, queryParams, err := Upgrade(w, r)
+	session, err := models.GetSession(r.URL.Query().Get("sessionId"))
 	if err != nil {
 		return err
 	}
 
-	session, err := models.GetSession(queryParams["sessionID"])
+	conn, _, err := Upgrade(w, r)
 	if err != nil {
-		return err
+		// The upgrader already answered the request.
+		log.Println(err)
+		return nil
 	}
 
+	pool.mu.Lock()
 	sessionRoom := pool.Sessions[session.ID]
 	if sessionRoom == nil {
 		sessionRoom = &SessionRoom{
@@ -164,19 +325,28 @@ func serveWS(pool *Pool, w http.ResponseWriter, r *http.Request) error {
 	}
 
 	sessionRoom.Clients[clientUUID] = client
+	pool.mu.Unlock()
+	models.TouchSession(session.ID)
 	pool.Register <- client
 	client.Read()
 
 	return nil
 }
 
+// WSPool is the pool DeployWS serves, services broadcast session events on it.
+var WSPool *Pool
+
 func DeployWS(router *mux.Router) *Pool {
 	pool := NewPool()
 	go pool.Start()
+	WSPool = pool
 
 	router.HandleFunc("/ws/", func(w http.ResponseWriter, r *http.Request) {
 		if err := serveWS(pool, w, r); err != nil {
-			fmt.Fprintf(w, "%+v\n", err)
+			if utils.KindOf(err) == utils.KindInternal {
+				log.Println(err)
+			}
+			http.Error(w, utils.PublicMessage(err), utils.HTTPStatus(err))
 		}
 	})
 
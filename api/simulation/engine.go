@@ -0,0 +1,276 @@
+package simulation
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Event is a callback scheduled to run at a point of virtual time, measured
+// from the moment the engine was created.
+type Event struct {
+	At   time.Duration
+	Name string
+
+	fn        func()
+	seq       uint64
+	index     int
+	cancelled bool
+}
+
+// eventQueue orders events by virtual time, events scheduled for the same time
+// run in the order they were scheduled.
+type eventQueue []*Event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].At == q[j].At {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].At < q[j].At
+}
+
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *eventQueue) Push(x interface{}) {
+	event := x.(*Event)
+	event.index = len(*q)
+	*q = append(*q, event)
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	event := old[n-1]
+	old[n-1] = nil
+	event.index = -1
+	*q = old[:n-1]
+	return event
+}
+
+// Engine is a discrete event simulation driven by a Clock. Virtual time moves
+// with the clock, events run once the virtual time reaches them, and an event
+// scheduled from inside another one is relative to the time of the running
+// event rather than to when the engine got around to it.
+type Engine struct {
+	mu    sync.Mutex
+	clock Clock
+	queue eventQueue
+	seq   uint64
+
+	// Virtual time is base plus the wall time since anchor scaled by speed, it
+	// is rebased every time the speed changes.
+	base   time.Duration
+	anchor time.Time
+	speed  float64
+	paused bool
+	// running is set while an event callback runs, current is its time.
+	running bool
+	current time.Duration
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewEngine(clock Clock) *Engine {
+	return &Engine{
+		clock:  clock,
+		anchor: clock.Now(),
+		speed:  1,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (e *Engine) now() time.Duration {
+	if e.running {
+		return e.current
+	}
+	return e.clockNow()
+}
+
+// clockNow is the virtual time according to the clock alone.
+func (e *Engine) clockNow() time.Duration {
+	if e.paused {
+		return e.base
+	}
+	elapsed := e.clock.Now().Sub(e.anchor)
+	return e.base + time.Duration(float64(elapsed)*e.speed)
+}
+
+func (e *Engine) rebase() {
+	e.base = e.clockNow()
+	e.anchor = e.clock.Now()
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SetSpeed makes virtual time run multiplier times as fast as the clock.
+func (e *Engine) SetSpeed(multiplier float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rebase()
+	e.speed = multiplier
+}
+
+// Pause freezes virtual time, nothing runs until Resume.
+func (e *Engine) Pause() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rebase()
+	e.paused = true
+}
+
+func (e *Engine) Resume() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rebase()
+	e.paused = false
+}
+
+// StartFrom moves virtual time to at, a session picked up after a restart
+// carries on from the time its lifts were last saved at.
+func (e *Engine) StartFrom(at time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rebase()
+	e.base = at
+}
+
+// Speed returns the multiplier and whether the engine is paused.
+func (e *Engine) Speed() (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.speed, e.paused
+}
+
+// Now is the current virtual time, inside an event callback it is the time the
+// event was scheduled for.
+func (e *Engine) Now() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now()
+}
+
+// Schedule runs fn once delay of virtual time has passed.
+func (e *Engine) Schedule(delay time.Duration, name string, fn func()) *Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if delay < 0 {
+		delay = 0
+	}
+	e.seq++
+	event := &Event{At: e.now() + delay, Name: name, fn: fn, seq: e.seq}
+	heap.Push(&e.queue, event)
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return event
+}
+
+// Cancel removes the event from the queue, it returns false when the event
+// already ran or was cancelled before.
+func (e *Engine) Cancel(event *Event) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if event == nil || event.cancelled || event.index < 0 {
+		return false
+	}
+	event.cancelled = true
+	heap.Remove(&e.queue, event.index)
+	return true
+}
+
+// Pending is the number of events waiting to run.
+func (e *Engine) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.queue)
+}
+
+// untilNext is the wall time to wait for the next event, -1 when the queue is
+// empty or the engine is paused.
+func (e *Engine) untilNext() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) == 0 || e.paused {
+		return -1
+	}
+	if wait := e.queue[0].At - e.now(); wait > 0 {
+		return time.Duration(float64(wait) / e.speed)
+	}
+	return 0
+}
+
+// popDue returns the next event whose time has come and marks it running.
+func (e *Engine) popDue() *Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) == 0 || e.queue[0].At > e.now() {
+		return nil
+	}
+	next := heap.Pop(&e.queue).(*Event)
+	e.running = true
+	e.current = next.At
+	return next
+}
+
+func (e *Engine) finish() {
+	e.mu.Lock()
+	e.running = false
+	e.mu.Unlock()
+}
+
+// RunDue runs every event whose time has come, in order, including the ones
+// they schedule on their way. It returns the number of events that ran.
+func (e *Engine) RunDue() int {
+	ran := 0
+	for {
+		event := e.popDue()
+		if event == nil {
+			return ran
+		}
+		event.fn()
+		e.finish()
+		ran++
+	}
+}
+
+// Start drives the engine from the clock in its own goroutine until Stop.
+func (e *Engine) Start() {
+	go func() {
+		for {
+			e.RunDue()
+
+			var timer <-chan time.Time
+			if wait := e.untilNext(); wait >= 0 {
+				timer = e.clock.After(wait)
+			}
+
+			select {
+			case <-e.stop:
+				return
+			case <-e.wake:
+			case <-timer:
+			}
+		}
+	}()
+}
+
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
@@ -0,0 +1,185 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestEngine() (*Engine, *FakeClock) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return NewEngine(clock), clock
+}
+
+func TestEngineRunsEventsInOrder(t *testing.T) {
+	engine, clock := newTestEngine()
+	var ran []string
+	record := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+	engine.Schedule(3*time.Second, "c", record("c"))
+	engine.Schedule(time.Second, "a", record("a"))
+	engine.Schedule(2*time.Second, "b", record("b"))
+	engine.Schedule(time.Second, "a2", record("a2"))
+
+	clock.Advance(500 * time.Millisecond)
+	if n := engine.RunDue(); n != 0 {
+		t.Fatalf("%d events ran before their time", n)
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if n := engine.RunDue(); n != 3 {
+		t.Fatalf("%d events ran after 2s, want 3", n)
+	}
+	clock.Advance(time.Second)
+	engine.RunDue()
+
+	want := []string{"a", "a2", "b", "c"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Fatalf("events ran as %v, want %v", ran, want)
+	}
+	if engine.Pending() != 0 {
+		t.Fatalf("%d events left", engine.Pending())
+	}
+}
+
+func TestEngineCancel(t *testing.T) {
+	engine, clock := newTestEngine()
+	ran := map[string]bool{}
+	kept := engine.Schedule(time.Second, "kept", func() { ran["kept"] = true })
+	dropped := engine.Schedule(time.Second, "dropped", func() { ran["dropped"] = true })
+
+	if !engine.Cancel(dropped) {
+		t.Fatal("cancelling a waiting event returned false")
+	}
+	if engine.Cancel(dropped) {
+		t.Fatal("cancelling an event twice returned true")
+	}
+	if engine.Pending() != 1 {
+		t.Fatalf("%d events pending, want 1", engine.Pending())
+	}
+
+	clock.Advance(time.Second)
+	engine.RunDue()
+	if !ran["kept"] || ran["dropped"] {
+		t.Fatalf("ran %v, want only kept", ran)
+	}
+	if engine.Cancel(kept) {
+		t.Fatal("cancelling an event that ran returned true")
+	}
+}
+
+func TestEnginePauseAndSpeed(t *testing.T) {
+	engine, clock := newTestEngine()
+	ran := false
+	engine.Schedule(4*time.Second, "due", func() { ran = true })
+
+	clock.Advance(time.Second)
+	engine.Pause()
+	clock.Advance(10 * time.Second)
+	if now := engine.Now(); now != time.Second {
+		t.Fatalf("virtual time moved to %v while paused, want 1s", now)
+	}
+	if engine.RunDue() != 0 || ran {
+		t.Fatal("event ran while paused")
+	}
+
+	engine.Resume()
+	engine.SetSpeed(2)
+	clock.Advance(time.Second)
+	if now := engine.Now(); now != 3*time.Second {
+		t.Fatalf("virtual time is %v after 1s at double speed, want 3s", now)
+	}
+
+	// The speed change rebases, the time run at double speed is kept.
+	engine.SetSpeed(0.5)
+	clock.Advance(time.Second)
+	if now := engine.Now(); now != 3500*time.Millisecond {
+		t.Fatalf("virtual time is %v after 1s at half speed, want 3.5s", now)
+	}
+	if speed, paused := engine.Speed(); speed != 0.5 || paused {
+		t.Fatalf("speed is %v paused %v, want 0.5 running", speed, paused)
+	}
+
+	clock.Advance(time.Second)
+	if engine.RunDue() != 1 || !ran {
+		t.Fatal("event didn't run once its virtual time came")
+	}
+}
+
+func TestEngineScheduleFromCallback(t *testing.T) {
+	engine, clock := newTestEngine()
+	var times []time.Duration
+	engine.Schedule(time.Second, "first", func() {
+		times = append(times, engine.Now())
+		engine.Schedule(time.Second, "second", func() {
+			times = append(times, engine.Now())
+		})
+	})
+	engine.Schedule(1500*time.Millisecond, "between", func() {
+		times = append(times, engine.Now())
+	})
+
+	// The engine got to the events late, the nested one is still relative to
+	// the time of the event that scheduled it.
+	clock.Advance(5 * time.Second)
+	if n := engine.RunDue(); n != 3 {
+		t.Fatalf("%d events ran, want 3", n)
+	}
+	want := []time.Duration{time.Second, 1500 * time.Millisecond, 2 * time.Second}
+	if !reflect.DeepEqual(times, want) {
+		t.Fatalf("events ran at %v, want %v", times, want)
+	}
+	if now := engine.Now(); now != 5*time.Second {
+		t.Fatalf("virtual time is %v outside callbacks, want 5s", now)
+	}
+}
+
+func TestEngineStartFollowsFakeClock(t *testing.T) {
+	engine, clock := newTestEngine()
+	done := make(chan time.Duration, 1)
+	engine.Schedule(2*time.Second, "due", func() { done <- engine.Now() })
+	engine.Start()
+	defer engine.Stop()
+
+	select {
+	case <-done:
+		t.Fatal("event ran before the clock moved")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The engine waits on a fake timer, advance until it fires.
+	deadline := time.After(time.Second)
+	for {
+		clock.Advance(time.Second)
+		select {
+		case at := <-done:
+			if at != 2*time.Second {
+				t.Fatalf("event ran at %v, want 2s", at)
+			}
+			return
+		case <-deadline:
+			t.Fatal("event never ran")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestEngineStartFrom(t *testing.T) {
+	engine, clock := newTestEngine()
+	engine.SetSpeed(2)
+	engine.StartFrom(10 * time.Second)
+	if now := engine.Now(); now != 10*time.Second {
+		t.Fatalf("virtual time is %v, want 10s", now)
+	}
+
+	ran := false
+	engine.Schedule(time.Second, "due", func() { ran = true })
+	clock.Advance(500 * time.Millisecond)
+	if engine.RunDue() != 1 || !ran {
+		t.Fatal("event didn't run a second of virtual time after the start")
+	}
+	if now := engine.Now(); now != 11*time.Second {
+		t.Fatalf("virtual time is %v, want 11s", now)
+	}
+}
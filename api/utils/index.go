@@ -1,19 +1,122 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type CustomError struct {
+// Kind is the category of an Error, it decides the HTTP status and the kind
+// reported in websocket error events.
+type Kind string
+
+const (
+	KindNotFound        Kind = "not_found"
+	KindInvalidArgument Kind = "invalid_argument"
+	KindConflict        Kind = "conflict"
+	KindUnavailable     Kind = "unavailable"
+	KindTooManyRequests Kind = "too_many_requests"
+	KindInternal        Kind = "internal"
+)
+
+type Error struct {
+	Kind    Kind
 	Message string
+	// Err is the underlying error, if any.
+	Err error
+	// RetryAfter tells the client when to try again, only set on too many
+	// requests errors.
+	RetryAfter time.Duration
 }
 
-// Error returns the error message for the CustomError type.
-func (e *CustomError) Error() string {
+// Error returns the error message for the Error type.
+func (e *Error) Error() string {
 	return e.Message
 }
 
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func InvalidArgument(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// Unavailable wraps err, a failure of something we depend on like the database.
+func Unavailable(err error, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindUnavailable, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// TooManyRequests turns a request away for now, the client can try again after
+// retryAfter.
+func TooManyRequests(retryAfter time.Duration, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindTooManyRequests, Message: fmt.Sprintf(format, args...), RetryAfter: retryAfter}
+}
+
+// Internal wraps an error we don't expect, its message is not shown to clients.
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Message: "internal error", Err: err}
+}
+
+// KindOf returns the kind of the error, errors that aren't an Error are internal.
+func KindOf(err error) Kind {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+	return KindInternal
+}
+
+// HTTPStatus maps the kind of the error to the status code of the response.
+// Invalid arguments get the same 422 as bodies that fail validation.
+func HTTPStatus(err error) int {
+	switch KindOf(err) {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindInvalidArgument:
+		return http.StatusUnprocessableEntity
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RetryAfter returns when the client can try the request again, 0 when the
+// error doesn't say.
+func RetryAfter(err error) time.Duration {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.RetryAfter
+	}
+	return 0
+}
+
+// PublicMessage is the message of the error that is safe to send to clients.
+func PublicMessage(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) && typed.Kind != KindInternal {
+		return typed.Message
+	}
+	return "internal error"
+}
+
 func GenerateUUID() primitive.ObjectID {
 	u := uuid.New()
 	return primitive.ObjectID(u[:])
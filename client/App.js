@@ -40,11 +40,12 @@ export default function App() {
     }
   };
 
-  const jumpToFloorClicked = async (floorToReach) => {
+  const jumpToFloorClicked = async (floorToReach, direction) => {
     let requestData = await createRequest(
       liftState._id,
       clientState.clientId,
-      floorToReach
+      floorToReach,
+      direction
     );
     let lift = requestData.lift;
     if (liftsSetterState[lift._id]) {
@@ -52,6 +53,8 @@ export default function App() {
       setFun({
         currentFloor: lift.currentFloor,
         floorToReach: requestData.requestedFloor,
+        travelDuration: requestData.eta,
+        doorDuration: liftState.kinematics?.doorDwell,
       });
     } else {
       console.error("lift setter not working properly");
@@ -66,8 +69,10 @@ export default function App() {
       if (liftsSetterState[liftId]) {
         let setFun = liftsSetterState[liftId];
         setFun({
-          currentFloor: lift.currentFloor,
+          currentFloor: requestData.from_floor ?? lift.currentFloor,
           floorToReach: requestData.floor_requested,
+          travelDuration: requestData.travel_duration,
+          doorDuration: requestData.door_duration,
         });
       } else {
         console.error("lift setter not working properly");
@@ -99,6 +104,10 @@ export default function App() {
     };
   }, [liftState, jumpToFloorClickedSocket]);
 
+  // sessions from older servers number their floors from 0
+  const minFloor = liftState.minFloor ?? 0;
+  const maxFloor = liftState.maxFloor ?? Number(liftState.floors) - 1;
+
   return (
     <ScrollView
       style={styles.container}
@@ -121,6 +130,7 @@ export default function App() {
               return (
                 <Lift
                   liftData={lift}
+                  minFloor={minFloor}
                   key={lift._id}
                   changeFloorSetter={updateLiftSetterFunc}
                 />
@@ -131,7 +141,12 @@ export default function App() {
             <Floor
               first={index === 0}
               last={index === Number(liftState.floors) - 1}
-              index={Number(liftState.floors) - 1 - index}
+              index={maxFloor - index}
+              label={
+                liftState.building?.floorLabels?.[
+                  Number(liftState.floors) - 1 - index
+                ]
+              }
               key={index}
               lifts={liftState.lifts.length}
               jumpToFloor={jumpToFloorClicked}
@@ -1,28 +1,40 @@
 import { Button } from "react-native";
-import { View, StyleSheet } from "react-native";
+import { View, StyleSheet, Text } from "react-native";
 
-export default function Floor({ first, last, index, lifts, jumpToFloor }) {
+export default function Floor({
+  first,
+  last,
+  index,
+  label,
+  lifts,
+  jumpToFloor,
+}) {
   const mainStyles = [styles.floor];
   if (first) mainStyles.push(styles.floor_first);
   if (last) mainStyles.push(styles.floor_last);
 
-  function requestLift() {
-    jumpToFloor(index + 1);
+  function requestLift(direction) {
+    jumpToFloor(index, direction);
   }
 
   return (
     <View style={mainStyles}>
+      <Text style={styles.floor_label}>{label ?? index}</Text>
       <View style={styles.floor_buttonWrapper}>
-        <Button
-          styles={styles.floor_upperButton}
-          title="->"
-          onPress={requestLift}
-        />
-        {/* <Button
-          styles={styles.floor_upperButton}
-          title="^"
-          onPress={requestLift}
-        /> */}
+        {!first && (
+          <Button
+            styles={styles.floor_upperButton}
+            title="^"
+            onPress={() => requestLift("up")}
+          />
+        )}
+        {!last && (
+          <Button
+            styles={styles.floor_lowerButton}
+            title="v"
+            onPress={() => requestLift("down")}
+          />
+        )}
       </View>
     </View>
   );
@@ -53,6 +65,12 @@ const styles = StyleSheet.create({
     paddingVertical: 5,
     paddingHorizontal: 9,
   },
+  floor_label: {
+    position: "absolute",
+    top: 5,
+    left: 10,
+    fontWeight: "bold",
+  },
   floor_buttonWrapper: {
     flexDirection: "row",
     justifyContent: "center",
@@ -1,15 +1,23 @@
 import { useEffect, useState } from "react";
-import { View, StyleSheet, Animated } from "react-native";
+import { View, StyleSheet, Animated, Text } from "react-native";
 
-export default function Lift({ liftData, changeFloorSetter }) {
+export default function Lift({ liftData, minFloor = 0, changeFloorSetter }) {
   const [moveLift] = useState(new Animated.Value(25));
   const [closeDoor] = useState(new Animated.Value(32));
 
   function changeFloor(request, removeEvent) {
     let floorDiff = Math.abs(request.floorToReach - request.currentFloor);
+    // durations come from the server in seconds, older servers don't send them
+    let travelDuration =
+      request.travelDuration !== undefined
+        ? request.travelDuration * 1000
+        : 2000 * floorDiff;
+    let doorDuration =
+      request.doorDuration !== undefined ? request.doorDuration * 1000 : 7000;
+
     Animated.timing(moveLift, {
-      toValue: (request.floorToReach - 1) * -125,
-      duration: 2000 * floorDiff,
+      toValue: (request.floorToReach - minFloor) * -125,
+      duration: travelDuration,
       useNativeDriver: true,
     }).start();
 
@@ -17,37 +25,29 @@ export default function Lift({ liftData, changeFloorSetter }) {
     let doorAnimation = Animated.sequence([
       Animated.timing(closeDoor, {
         toValue: 0,
-        duration: 2500,
+        duration: doorDuration * 0.35,
         useNativeDriver: false,
-        delay: 2000 * floorDiff,
+        delay: travelDuration,
       }),
       Animated.timing(closeDoor, {
         toValue: 32,
-        duration: 2500,
+        duration: doorDuration * 0.35,
         useNativeDriver: false,
-        delay: 2000,
+        delay: doorDuration * 0.3,
       }),
     ]);
 
     doorAnimation.start();
-    if (removeEvent) setTimeout(removeEvent, 2000 * floorDiff + 5000);
+    if (removeEvent) setTimeout(removeEvent, travelDuration + doorDuration);
   }
 
   useEffect(() => {
     changeFloorSetter(changeFloor, liftData._id);
-    if (liftData.currentFloor === 0) {
-      Animated.timing(moveLift, {
-        toValue: (liftData.currentFloor) * -125,
-        duration: 0,
-        useNativeDriver: true,
-      }).start();
-    } else {
-      Animated.timing(moveLift, {
-        toValue: (liftData.currentFloor - 1) * -125,
-        duration: 0,
-        useNativeDriver: true,
-      }).start();
-    }
+    Animated.timing(moveLift, {
+      toValue: (liftData.currentFloor - minFloor) * -125,
+      duration: 0,
+      useNativeDriver: true,
+    }).start();
   }, []);
 
   return (
@@ -65,6 +65,9 @@ export default function Lift({ liftData, changeFloorSetter }) {
       <Animated.View
         style={[styles.rightDoor, { width: closeDoor }]}
       ></Animated.View>
+      {liftData.name ? (
+        <Text style={styles.name}>{liftData.name}</Text>
+      ) : null}
     </Animated.View>
   );
 }
@@ -89,4 +92,10 @@ const styles = StyleSheet.create({
     width: 32,
     backgroundColor: "#555",
   },
+  name: {
+    position: "absolute",
+    top: -18,
+    width: "100%",
+    textAlign: "center",
+  },
 });
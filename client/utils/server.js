@@ -16,12 +16,36 @@ const fetchSession = async (sessionId) => {
   return response.data;
 };
 
-const createRequest = async (sessionId, clientId, floor) => {
+const createRequest = async (sessionId, clientId, floor, direction) => {
   const response = await fetch.post(`/session/${sessionId}/request`, {
     floor,
+    direction,
     clientId,
   });
   return response.data;
 };
 
-export { createSession, fetchSession, createRequest, baseurl };
+const cancelRequest = async (sessionId, clientId, requestId) => {
+  const response = await fetch.delete(
+    `/session/${sessionId}/request/${requestId}`,
+    { params: { clientId } }
+  );
+  return response.data;
+};
+
+const addDestination = async (sessionId, clientId, liftId, floor) => {
+  const response = await fetch.post(
+    `/session/${sessionId}/lift/${liftId}/destination`,
+    { floor, clientId }
+  );
+  return response.data;
+};
+
+export {
+  createSession,
+  fetchSession,
+  createRequest,
+  cancelRequest,
+  addDestination,
+  baseurl,
+};